@@ -0,0 +1,255 @@
+package condition
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"test/event"
+)
+
+//判断一条日志是否满足条件,过滤、路由、采样等功能都用同一种表达式,比如:
+//
+//	level in ["DEBUG","TRACE"] && path =~ "healthz"
+//
+//左边是字段名,用event.Get取值(message、Body里解析出来的字段、Fields里的元数据),右边是字面量
+//  kubernetes.pod.name这样带.的名字可以取json_decode解析出来的嵌套对象里的字段
+//  ==、!=:字符串比较,右边是数字且字段也是数字时按数字比较
+//  <、<=、>、>=:按数字比较,字段不是数字时不满足
+//  =~、!~:正则匹配,'...'里的内容不处理转义,写正则方便
+//  in:等于列表里的某一个,如status in [500,502,503]
+//  只写字段名:字段存在并且不是空字符串或false
+//可以用&&、||、!和括号组合;字段不存在时值当作空字符串,所以 x != "a" 成立
+
+// Condition 编译好的条件,可以在多个goroutine里共用
+type Condition struct {
+	expr string
+	root node
+}
+
+// Compile 编译条件表达式
+func Compile(expr string) (c *Condition, err error) {
+	tokens, err := lex(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid condition %q,%v", expr, err)
+	}
+	p := &parser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, fmt.Errorf("invalid condition %q,%v", expr, err)
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, fmt.Errorf("invalid condition %q,at %d:unexpected %q", expr, t.pos, t.text)
+	}
+	return &Condition{expr: expr, root: root}, nil
+}
+
+// Match ev是否满足条件
+func (c *Condition) Match(ev *event.Event) bool {
+	return c.root.eval(ev)
+}
+
+func (c *Condition) String() string {
+	return c.expr
+}
+
+type node interface {
+	eval(ev *event.Event) bool
+}
+
+type andNode struct{ left, right node }
+
+func (n *andNode) eval(ev *event.Event) bool { return n.left.eval(ev) && n.right.eval(ev) }
+
+type orNode struct{ left, right node }
+
+func (n *orNode) eval(ev *event.Event) bool { return n.left.eval(ev) || n.right.eval(ev) }
+
+type notNode struct{ x node }
+
+func (n *notNode) eval(ev *event.Event) bool { return !n.x.eval(ev) }
+
+// truthNode 只写了字段名
+type truthNode struct{ field string }
+
+func (n *truthNode) eval(ev *event.Event) bool {
+	v, ok := ev.Get(n.field)
+	return ok && v != "" && v != "false"
+}
+
+// compareNode 字段和字面量比较
+type compareNode struct {
+	field string
+	op    string
+	value string         //字面量,数字是原来的写法
+	num   float64        //字面量是数字时的值
+	isNum bool           //字面量是不是数字
+	re    *regexp.Regexp //=~、!~的正则
+	list  map[string]bool
+}
+
+func (n *compareNode) eval(ev *event.Event) bool {
+	v, _ := ev.Get(n.field)
+	switch n.op {
+	case "=~":
+		return n.re.MatchString(v)
+	case "!~":
+		return !n.re.MatchString(v)
+	case "in":
+		return n.list[v]
+	case "==", "!=":
+		equal := v == n.value
+		if f, err := strconv.ParseFloat(v, 64); err == nil && n.isNum {
+			equal = f == n.num
+		}
+		return equal == (n.op == "==")
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return false
+	}
+	switch n.op {
+	case "<":
+		return f < n.num
+	case "<=":
+		return f <= n.num
+	case ">":
+		return f > n.num
+	default:
+		return f >= n.num
+	}
+}
+
+type parser struct {
+	tokens []token
+	i      int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.i]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.i]
+	if t.kind != tokEOF {
+		p.i++
+	}
+	return t
+}
+
+// accept 下一个是op时跳过它
+func (p *parser) accept(op string) bool {
+	if t := p.peek(); t.kind == tokOp && t.text == op {
+		p.i++
+		return true
+	}
+	return false
+}
+
+func (p *parser) parseOr() (n node, err error) {
+	n, err = p.parseAnd()
+	for err == nil && p.accept("||") {
+		var right node
+		right, err = p.parseAnd()
+		n = &orNode{left: n, right: right}
+	}
+	return
+}
+
+func (p *parser) parseAnd() (n node, err error) {
+	n, err = p.parseUnary()
+	for err == nil && p.accept("&&") {
+		var right node
+		right, err = p.parseUnary()
+		n = &andNode{left: n, right: right}
+	}
+	return
+}
+
+func (p *parser) parseUnary() (n node, err error) {
+	if p.accept("!") {
+		n, err = p.parseUnary()
+		return &notNode{x: n}, err
+	}
+	if p.accept("(") {
+		n, err = p.parseOr()
+		if err == nil && !p.accept(")") {
+			err = unexpected(p.peek(), `")"`)
+		}
+		return
+	}
+	return p.parseCompare()
+}
+
+func (p *parser) parseCompare() (n node, err error) {
+	t := p.next()
+	if t.kind != tokIdent {
+		return nil, unexpected(t, "field name")
+	}
+	op := p.peek()
+	isOp := op.kind == tokOp
+	switch {
+	case op.kind == tokIdent && op.text == "in":
+	case isOp && (op.text == "==" || op.text == "!=" || op.text == "=~" || op.text == "!~"):
+	case isOp && (op.text == "<" || op.text == "<=" || op.text == ">" || op.text == ">="):
+	default:
+		return &truthNode{field: t.text}, nil
+	}
+	p.next()
+	c := &compareNode{field: t.text, op: op.text}
+	if op.text == "in" {
+		c.list, err = p.parseList()
+		return c, err
+	}
+	lit := p.next()
+	if lit.kind != tokString && lit.kind != tokNumber {
+		return nil, unexpected(lit, "string or number")
+	}
+	c.value = lit.text
+	if lit.kind == tokNumber {
+		c.num, _ = strconv.ParseFloat(lit.text, 64)
+		c.isNum = true
+	}
+	switch op.text {
+	case "=~", "!~":
+		c.re, err = regexp.Compile(lit.text)
+		if err != nil {
+			return nil, fmt.Errorf("at %d:invalid regex %q,%v", lit.pos, lit.text, err)
+		}
+	case "<", "<=", ">", ">=":
+		if !c.isNum {
+			return nil, unexpected(lit, "number")
+		}
+	}
+	return c, nil
+}
+
+// parseList [字面量,字面量...]
+func (p *parser) parseList() (list map[string]bool, err error) {
+	if !p.accept("[") {
+		return nil, unexpected(p.peek(), `"["`)
+	}
+	list = make(map[string]bool)
+	if p.accept("]") {
+		return
+	}
+	for {
+		lit := p.next()
+		if lit.kind != tokString && lit.kind != tokNumber {
+			return nil, unexpected(lit, "string or number")
+		}
+		list[lit.text] = true
+		if p.accept("]") {
+			return
+		}
+		if !p.accept(",") {
+			return nil, unexpected(p.peek(), `"," or "]"`)
+		}
+	}
+}
+
+func unexpected(t token, want string) error {
+	if t.kind == tokEOF {
+		return fmt.Errorf("at %d:unexpected end,want %s", t.pos, want)
+	}
+	return fmt.Errorf("at %d:unexpected %q,want %s", t.pos, t.text, want)
+}
@@ -0,0 +1,137 @@
+package condition
+
+import (
+	"strings"
+	"test/event"
+	"testing"
+)
+
+func TestMatch(t *testing.T) {
+	ev := &event.Event{
+		Data:   "GET /healthz 200",
+		Fields: map[string]string{"source": "/var/log/app.log"},
+		Body: map[string]interface{}{
+			"level":      "WARN",
+			"status":     int64(200),
+			"latency":    "1.50",
+			"code":       "007",
+			"path":       `C:\logs`,
+			"quote":      `say "hi"`,
+			"debug":      false,
+			"@timestamp": "2024-01-02",
+			"x-user":     "alice",
+			"user.name":  "bob",
+			"kubernetes": map[string]interface{}{
+				"pod":    map[string]interface{}{"name": "web-1"},
+				"labels": map[string]interface{}{"app.tier": "db"},
+			},
+		},
+	}
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		//优先级:&&比||高,!比&&高
+		{`level == "WARN" || level == "INFO" && status == 500`, true},
+		{`(level == "WARN" || level == "INFO") && status == 500`, false},
+		{`level == "INFO" && status == 500 || status == 200`, true},
+		{`!level == "INFO" && status == 200`, true},
+		{`!(level == "WARN" && status == 200)`, false},
+		{`!!level`, true},
+		{`level == "INFO" || level == "DEBUG" || status >= 200`, true},
+
+		//in
+		{`level in ["DEBUG","WARN"]`, true},
+		{`level in ["DEBUG","TRACE"]`, false},
+		{`status in [500,502,200]`, true},
+		{`status in []`, false},
+		{`missing in [""]`, true},
+
+		//数字和字符串的==
+		{`status == 200`, true},
+		{`status == 200.0`, true},
+		{`status == "200.0"`, false},
+		{`latency == 1.5`, true},
+		{`latency == "1.5"`, false},
+		{`code == 7`, true},
+		{`code == "7"`, false},
+		{`code != "007"`, false},
+		{`level == 0`, false},
+		{`status > 199 && status <= 200`, true},
+		{`latency < 1`, false},
+		{`level > 0`, false},
+		{`status >= -1`, true},
+
+		//引号和转义
+		{`quote == "say \"hi\""`, true},
+		{`path == "C:\\logs"`, true},
+		{`path == 'C:\logs'`, true},
+		{`message =~ '^GET /\w+ \d{3}$'`, true},
+		{`message !~ "healthz"`, false},
+
+		//字段
+		{`message =~ "healthz"`, true},
+		{`source == "/var/log/app.log"`, true},
+		{`@timestamp == "2024-01-02"`, true},
+		{`x-user == "alice"`, true},
+		{`user.name == "bob"`, true},
+		{`kubernetes.pod.name == "web-1"`, true},
+		{`kubernetes.labels.app.tier == "db"`, true},
+		{`kubernetes.pod == '{"name":"web-1"}'`, true},
+		{`kubernetes.pod.uid`, false},
+		{`level.x`, false},
+		{`debug`, false},
+		{`level`, true},
+		{`missing`, false},
+		{`missing != "a"`, true},
+		{`missing == ""`, true},
+	}
+	for _, tt := range tests {
+		c, err := Compile(tt.expr)
+		if err != nil {
+			t.Errorf("Compile(%q) err = %v", tt.expr, err)
+			continue
+		}
+		if got := c.Match(ev); got != tt.want {
+			t.Errorf("%s = %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestCompileError(t *testing.T) {
+	tests := []struct {
+		expr string
+		err  string
+	}{
+		{``, `at 0:unexpected end,want field name`},
+		{`level ==`, `at 8:unexpected end,want string or number`},
+		{`level == WARN`, `at 9:unexpected "WARN",want string or number`},
+		{`"WARN" == level`, `at 0:unexpected "WARN",want field name`},
+		{`(level == "WARN"`, `at 16:unexpected end,want ")"`},
+		{`level == "WARN")`, `at 15:unexpected ")"`},
+		{`level == "WARN" status`, `at 16:unexpected "status"`},
+		{`level == "WARN" &&`, `at 18:unexpected end,want field name`},
+		{`status < "500"`, `at 9:unexpected "500",want number`},
+		{`level in "WARN"`, `at 9:unexpected "WARN",want "["`},
+		{`level in ["WARN" "INFO"]`, `at 17:unexpected "INFO",want "," or "]"`},
+		{`level in ["WARN",]`, `at 17:unexpected "]",want string or number`},
+		{`level in ["WARN"`, `at 16:unexpected end,want "," or "]"`},
+		{`message =~ "("`, `at 11:invalid regex "("`},
+		{`level == "WARN`, `at 9:unterminated string`},
+		{`level == 'WARN`, `at 9:unterminated string`},
+		{`level == "\q"`, `at 9:invalid string "\q"`},
+		{`status == 1.2.3`, `at 10:invalid number 1.2.3`},
+		{`level = "WARN"`, `at 6:unexpected character '='`},
+		{`level == "WARN" & status`, `at 16:unexpected character '&'`},
+	}
+	for _, tt := range tests {
+		_, err := Compile(tt.expr)
+		if err == nil {
+			t.Errorf("Compile(%q) err = nil, want %q", tt.expr, tt.err)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("Compile(%q) err = %v, want %q", tt.expr, err, tt.err)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package condition
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+//把表达式切成一个个记号
+
+type tokenKind int
+
+const (
+	tokEOF    tokenKind = iota
+	tokIdent            //字段名
+	tokString           //"..."可以转义,'...'原样,写正则时方便
+	tokNumber
+	tokOp //运算符和括号、逗号
+)
+
+type token struct {
+	kind tokenKind
+	text string //字符串是去掉引号、处理过转义的内容
+	pos  int    //在表达式里的位置,报错用
+}
+
+// ops 长的写在前面
+var ops = []string{"&&", "||", "==", "!=", "=~", "!~", "<=", ">=", "<", ">", "!", "(", ")", "[", "]", ","}
+
+func lex(expr string) (tokens []token, err error) {
+	i := 0
+	for {
+		for i < len(expr) && strings.IndexByte(" \t\r\n", expr[i]) >= 0 {
+			i++
+		}
+		if i == len(expr) {
+			tokens = append(tokens, token{kind: tokEOF, pos: i})
+			return
+		}
+		c := expr[i]
+		switch {
+		case c == '"':
+			j := i + 1
+			for j < len(expr) && expr[j] != '"' {
+				if expr[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(expr) {
+				return nil, fmt.Errorf("at %d:unterminated string", i)
+			}
+			s, err := strconv.Unquote(expr[i : j+1])
+			if err != nil {
+				return nil, fmt.Errorf("at %d:invalid string %s", i, expr[i:j+1])
+			}
+			tokens = append(tokens, token{kind: tokString, text: s, pos: i})
+			i = j + 1
+		case c == '\'':
+			j := strings.IndexByte(expr[i+1:], '\'')
+			if j < 0 {
+				return nil, fmt.Errorf("at %d:unterminated string", i)
+			}
+			tokens = append(tokens, token{kind: tokString, text: expr[i+1 : i+1+j], pos: i})
+			i += j + 2
+		case c >= '0' && c <= '9' || c == '-' && i+1 < len(expr) && expr[i+1] >= '0' && expr[i+1] <= '9':
+			j := i + 1
+			for j < len(expr) && (expr[j] >= '0' && expr[j] <= '9' || expr[j] == '.') {
+				j++
+			}
+			if _, err := strconv.ParseFloat(expr[i:j], 64); err != nil {
+				return nil, fmt.Errorf("at %d:invalid number %s", i, expr[i:j])
+			}
+			tokens = append(tokens, token{kind: tokNumber, text: expr[i:j], pos: i})
+			i = j
+		case isIdentStart(c):
+			j := i + 1
+			for j < len(expr) && isIdentPart(expr[j]) {
+				j++
+			}
+			tokens = append(tokens, token{kind: tokIdent, text: expr[i:j], pos: i})
+			i = j
+		default:
+			op := ""
+			for _, o := range ops {
+				if strings.HasPrefix(expr[i:], o) {
+					op = o
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("at %d:unexpected character %q", i, c)
+			}
+			tokens = append(tokens, token{kind: tokOp, text: op, pos: i})
+			i += len(op)
+		}
+	}
+}
+
+// isIdentStart 字段名可以是@timestamp、kubernetes.pod、x-request-id这样的
+func isIdentStart(c byte) bool {
+	return c == '_' || c == '@' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func isIdentPart(c byte) bool {
+	return isIdentStart(c) || c >= '0' && c <= '9' || c == '.' || c == '-'
+}
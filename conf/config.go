@@ -1,15 +1,301 @@
 package conf
 
+import (
+	"fmt"
+	"gopkg.in/ini.v1"
+	"strings"
+	"time"
+)
+
+// defaultMaxBytes 一条日志默认最多多少字节,比kafka默认的message.max.bytes(约1MB)小,给消息头留出空间
+const defaultMaxBytes = 512 * 1024
+
 type AppConf struct {
-	KafkaConf `ini:"kafka"`
-	LogConf   `ini:"taillog"`
+	KafkaConf      `ini:"kafka"`
+	RegistryConf   `ini:"registry"`
+	TaillogConf    `ini:"taillog"`
+	SyslogConf     `ini:"syslog"`
+	TCPConf        `ini:"tcp"`
+	HTTPConf       `ini:"http"`
+	CollectEntries []*CollectEntry `ini:"-"` //每个[taillog.xxx]小节对应一个收集项
+	ExecEntries    []*ExecEntry    `ini:"-"` //每个[exec.xxx]小节对应一个定时执行的命令
+	ConsumeEntries []*ConsumeEntry `ini:"-"` //每个[consumer.xxx]小节对应一个kafka消费组
+
+	Processors map[string]*ProcessorConf `ini:"-"` //每个[processor.xxx]小节是一个处理器,key为xxx
+}
+
+// ProcessorConf 一个处理器,收集项的processors按名字引用
+type ProcessorConf struct {
+	Name    string
+	Type    string            //处理器类型,内置的或者用processor.Register注册的
+	Options map[string]string //小节里除了type之外的配置项,交给处理器自己解析
 }
 
 type KafkaConf struct {
 	Address string `ini:"address"`
-	Topic   string `ini:"topic"`
+	Topic   string `ini:"topic"` //收集项没有配置topic时使用的默认topic
+}
+
+// RegistryConf 记录每个文件收集进度的registry文件
+type RegistryConf struct {
+	Path          string        `ini:"path"`
+	FlushInterval time.Duration `ini:"flush_interval"` //多久把收集进度写一次磁盘
+	TTL           time.Duration `ini:"ttl"`            //超过这么久没有更新的文件记录会被清掉,0表示不清理
 }
 
-type LogConf struct {
-	FileName string `ini:"path"`
+// TaillogConf 所有收集项共用的配置
+type TaillogConf struct {
+	MaxOpenFiles int `ini:"max_open_files"` //最多同时打开多少个日志文件,0表示不限制
+}
+
+// SyslogConf syslog输入,udp_address和tcp_address都为空时不启动
+type SyslogConf struct {
+	UDPAddress     string   `ini:"udp_address"`
+	TCPAddress     string   `ini:"tcp_address"`
+	Topic          string   `ini:"topic"`
+	MaxMessageSize int      `ini:"max_message_size"`     //一条消息最多多少字节,超出的部分丢弃并带上truncated=true
+	Processors     []string `ini:"processors" delim:","` //按顺序经过哪些处理器
+}
+
+// TCPConf 按换行分隔的tcp输入,address为空时不启动
+type TCPConf struct {
+	Address     string   `ini:"address"`
+	Topic       string   `ini:"topic"`
+	MaxLineSize int      `ini:"max_line_size"` //一行最多多少字节,超出的部分丢弃并带上truncated=true
+	TLSCert     string   `ini:"tls_cert"`      //配置了证书和私钥时开启tls
+	TLSKey      string   `ini:"tls_key"`
+	TLSClientCA string   `ini:"tls_client_ca"`        //配置了时只接受这个CA签发的客户端证书
+	Processors  []string `ini:"processors" delim:","` //按顺序经过哪些处理器
+}
+
+// HTTPConf http输入,address为空时不启动
+type HTTPConf struct {
+	Address     string        `ini:"address"`
+	QueueSize   int           `ini:"queue_size"`           //内部队列能放多少条日志,放不下时返回429
+	MaxBodySize int64         `ini:"max_body_size"`        //一次请求最多多少字节
+	AckTimeout  time.Duration `ini:"ack_timeout"`          //等kafka确认的超时时间
+	MaxBytes    int           `ini:"max_bytes"`            //一条日志最多多少字节,超出的截断并带上truncated=true
+	Topics      []string      `ini:"topics" delim:","`     //允许写入的topic,可以用app-*这样的通配符,为空时允许除了__开头的所有topic
+	Processors  []string      `ini:"processors" delim:","` //按顺序经过哪些处理器
+}
+
+// ExecEntry 定时执行一个命令,把输出发到kafka
+type ExecEntry struct {
+	Name       string        `ini:"-"`                    //小节名,如[exec.df]中的df,作为消息头command发送
+	Command    string        `ini:"command"`              //要执行的命令,用sh -c(windows下cmd /C)执行,可以带管道
+	Topic      string        `ini:"topic"`                //发往kafka的哪个topic
+	Interval   time.Duration `ini:"interval"`             //多久执行一次,上一次还没结束时跳过这一次
+	Timeout    time.Duration `ini:"timeout"`              //超过这么久没结束就杀掉,0表示不超时
+	Mode       string        `ini:"mode"`                 //lines:每行输出是一条消息 whole:整个输出是一条消息
+	MaxBytes   int           `ini:"max_bytes"`            //一条消息最多多少字节,超出的截断并带上truncated=true
+	Processors []string      `ini:"processors" delim:","` //按顺序经过哪些处理器
+}
+
+// ConsumeEntry 用消费组从kafka的topic读日志,处理后发到另一个topic
+type ConsumeEntry struct {
+	Name          string   `ini:"-"`                    //小节名,如[consumer.raw]中的raw
+	Brokers       string   `ini:"brokers"`              //从哪个集群消费,为空时用[kafka]的address
+	Group         string   `ini:"group"`                //消费组名
+	Topics        []string `ini:"topics" delim:","`     //消费哪些topic,逗号分隔
+	Topic         string   `ini:"topic"`                //处理后发往的topic
+	InitialOffset string   `ini:"initial_offset"`       //消费组没有提交过偏移时从哪开始:oldest或newest
+	MaxInflight   int      `ini:"max_inflight"`         //每个分区最多多少条发出去还没确认,超出时暂停消费
+	MaxBytes      int      `ini:"max_bytes"`            //一条日志最多多少字节,超出的截断并带上truncated=true
+	Processors    []string `ini:"processors" delim:","` //按顺序经过哪些处理器,比如把原始日志解析成结构化的
+}
+
+// CollectEntry 一个日志收集项:要收集的日志路径以及发往的topic
+type CollectEntry struct {
+	Name               string        `ini:"-"`                    //小节名,如[taillog.nginx]中的nginx
+	Path               string        `ini:"path"`                 //日志文件路径,支持*?[]通配符和匹配多层目录的**
+	Topic              string        `ini:"topic"`                //发往kafka的哪个topic
+	MustExist          bool          `ini:"must_exist"`           //文件不存在时是否报错
+	ScanFrequency      time.Duration `ini:"scan_frequency"`       //path带通配符时多久重新扫描一次
+	StartPosition      string        `ini:"start_position"`       //registry里没有记录的文件从哪开始读:beginning或end
+	BackfillArchives   bool          `ini:"backfill_archives"`    //跟踪前先按从旧到新读一遍切割出来的app.log.N[.gz|.zst]
+	WatchMode          string        `ini:"watch_mode"`           //怎么发现文件变化:inotify、poll或auto
+	PollInterval       time.Duration `ini:"poll_interval"`        //轮询模式下多久检查一次文件
+	Format             string        `ini:"format"`               //日志格式:plain、docker(json-file)或cri
+	Encoding           string        `ini:"encoding"`             //日志文件的编码:utf-8、gbk、gb18030、utf-16、utf-16le、utf-16be
+	CloseInactive      time.Duration `ini:"close_inactive"`       //超过这么久没有新数据就关闭文件,文件有变化再打开,0表示不关闭
+	Delimiter          string        `ini:"delimiter"`            //一条日志的结束标记,默认换行符,可以写\r\n、\x00这样的转义,regex:开头的是正则
+	PartialLineTimeout time.Duration `ini:"partial_line_timeout"` //文件末尾没有结束标记的半行超过这么久没变化就带上partial=true发出去,0表示一直等
+	MaxBytes           int           `ini:"max_bytes"`            //一条日志最多多少字节,超出的截断并带上truncated=true
+	SkipBinary         bool          `ini:"skip_binary"`          //跳过开头看起来不是文本的文件,比如压缩包、可执行文件
+	FileIdentity       string        `ini:"file_identity"`        //怎么识别同一个文件:inode、fingerprint或fingerprint_inode
+	FingerprintSize    int           `ini:"fingerprint_size"`     //按文件开头多少字节算指纹,不够这么多字节的文件先不读
+	Processors         []string      `ini:"processors" delim:","` //按顺序经过哪些处理器,引用[processor.xxx]的名字
+
+	//多行合并,multiline_pattern为空时不合并
+	MultilinePattern  string        `ini:"multiline_pattern"`   //判断一行是不是要合并的正则
+	MultilineNegate   bool          `ini:"multiline_negate"`    //为true时不匹配pattern的行才要合并
+	MultilineMatch    string        `ini:"multiline_match"`     //after:合并到上一行后面 before:合并到下一行前面
+	MultilineMaxLines int           `ini:"multiline_max_lines"` //一条日志最多多少行,超出的丢弃并带上truncated=true
+	MultilineTimeout  time.Duration `ini:"multiline_timeout"`   //多久没有新行就把已经合并的发出去
+}
+
+// Load 加载配置文件
+// [taillog]小节里的配置项作为所有[taillog.xxx]收集项的默认值
+func Load(fileName string, cfg *AppConf) (err error) {
+	file, err := ini.Load(fileName)
+	if err != nil {
+		return
+	}
+	err = file.MapTo(cfg)
+	if err != nil {
+		return
+	}
+	if cfg.RegistryConf.Path == "" {
+		cfg.RegistryConf.Path = "./data/registry.json"
+	}
+	if cfg.RegistryConf.FlushInterval <= 0 {
+		cfg.RegistryConf.FlushInterval = time.Second
+	}
+	if !file.Section("registry").HasKey("ttl") {
+		cfg.RegistryConf.TTL = 72 * time.Hour
+	}
+	if cfg.SyslogConf.Topic == "" {
+		cfg.SyslogConf.Topic = cfg.KafkaConf.Topic
+	}
+	if cfg.SyslogConf.MaxMessageSize <= 0 {
+		cfg.SyslogConf.MaxMessageSize = 64 * 1024
+	}
+	if cfg.TCPConf.Topic == "" {
+		cfg.TCPConf.Topic = cfg.KafkaConf.Topic
+	}
+	if cfg.TCPConf.MaxLineSize <= 0 {
+		cfg.TCPConf.MaxLineSize = 1024 * 1024
+	}
+	if cfg.HTTPConf.QueueSize <= 0 {
+		cfg.HTTPConf.QueueSize = 10000
+	}
+	if cfg.HTTPConf.MaxBodySize <= 0 {
+		cfg.HTTPConf.MaxBodySize = 10 * 1024 * 1024
+	}
+	if cfg.HTTPConf.AckTimeout <= 0 {
+		cfg.HTTPConf.AckTimeout = 30 * time.Second
+	}
+	if !file.Section("http").HasKey("max_bytes") {
+		cfg.HTTPConf.MaxBytes = defaultMaxBytes
+	}
+
+	//老的配置只有[taillog] path=xxx,没有[taillog.xxx]小节时把它当作一个叫default的收集项
+	cfg.CollectEntries = cfg.CollectEntries[:0]
+	sections := file.Section("taillog").ChildSections()
+	if len(sections) == 0 && file.Section("taillog").HasKey("path") {
+		sections = []*ini.Section{file.Section("taillog")}
+	}
+	for _, sec := range sections {
+		name := strings.TrimPrefix(sec.Name(), "taillog.")
+		if sec.Name() == "taillog" {
+			name = "default"
+		}
+		entry := &CollectEntry{
+			Name:          name,
+			ScanFrequency: 10 * time.Second,
+			StartPosition: "end",
+			WatchMode:     "auto",
+			PollInterval:  250 * time.Millisecond,
+			CloseInactive: 5 * time.Minute,
+
+			MultilineMatch:    "after",
+			MultilineMaxLines: 500,
+			MultilineTimeout:  5 * time.Second,
+			MaxBytes:          defaultMaxBytes,
+			SkipBinary:        true,
+			FileIdentity:      "inode",
+			FingerprintSize:   1024,
+		}
+		err = sec.MapTo(entry)
+		if err != nil {
+			return
+		}
+		if entry.Path == "" {
+			return fmt.Errorf("taillog.%s:path is empty", entry.Name)
+		}
+		if entry.Topic == "" {
+			entry.Topic = cfg.KafkaConf.Topic
+		}
+		if entry.ScanFrequency <= 0 {
+			entry.ScanFrequency = 10 * time.Second
+		}
+		if entry.PollInterval <= 0 {
+			entry.PollInterval = 250 * time.Millisecond
+		}
+		if entry.MultilineTimeout <= 0 {
+			entry.MultilineTimeout = 5 * time.Second
+		}
+		cfg.CollectEntries = append(cfg.CollectEntries, entry)
+	}
+
+	//[exec]小节里的配置项作为所有[exec.xxx]的默认值
+	cfg.ExecEntries = cfg.ExecEntries[:0]
+	for _, sec := range file.Section("exec").ChildSections() {
+		entry := &ExecEntry{
+			Name:     sec.Name()[len("exec."):],
+			Interval: time.Minute,
+			Timeout:  30 * time.Second,
+			Mode:     "lines",
+			MaxBytes: defaultMaxBytes,
+		}
+		err = sec.MapTo(entry)
+		if err != nil {
+			return
+		}
+		if entry.Topic == "" {
+			entry.Topic = cfg.KafkaConf.Topic
+		}
+		if entry.Interval <= 0 {
+			entry.Interval = time.Minute
+		}
+		cfg.ExecEntries = append(cfg.ExecEntries, entry)
+	}
+
+	//[consumer]小节里的配置项作为所有[consumer.xxx]的默认值
+	cfg.ConsumeEntries = cfg.ConsumeEntries[:0]
+	for _, sec := range file.Section("consumer").ChildSections() {
+		entry := &ConsumeEntry{
+			Name:          sec.Name()[len("consumer."):],
+			Group:         "logagent",
+			InitialOffset: "newest",
+			MaxInflight:   256,
+			MaxBytes:      defaultMaxBytes,
+		}
+		err = sec.MapTo(entry)
+		if err != nil {
+			return
+		}
+		if entry.Topic == "" {
+			entry.Topic = cfg.KafkaConf.Topic
+		}
+		if entry.MaxInflight <= 0 {
+			entry.MaxInflight = 256
+		}
+		if entry.Brokers == "" {
+			entry.Brokers = cfg.KafkaConf.Address
+			//同一个集群里发回正在消费的topic会无限循环
+			for _, t := range entry.Topics {
+				if t == entry.Topic {
+					return fmt.Errorf("consumer.%s:topic %q is also consumed", entry.Name, t)
+				}
+			}
+		}
+		cfg.ConsumeEntries = append(cfg.ConsumeEntries, entry)
+	}
+
+	cfg.Processors = make(map[string]*ProcessorConf)
+	for _, sec := range file.Section("processor").ChildSections() {
+		p := &ProcessorConf{
+			Name:    sec.Name()[len("processor."):],
+			Type:    sec.Key("type").String(),
+			Options: make(map[string]string),
+		}
+		for _, key := range sec.Keys() {
+			if key.Name() != "type" {
+				p.Options[key.Name()] = key.String()
+			}
+		}
+		cfg.Processors[p.Name] = p
+	}
+	return
 }
@@ -0,0 +1,150 @@
+package event
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+//各种输入(日志文件、syslog等)产生的日志都转成Event,再交给kafka发送
+//没有经过解析的日志发送的就是Data;被json_decode等处理器解析过的日志有Body,
+//发送的是{"message":Data,"@timestamp":Time,Body里的字段...}这样的json信封,下游拿到的格式都一样
+
+// Event 一条要发往kafka的日志
+type Event struct {
+	Topic  string
+	Data   string
+	Fields map[string]string //元数据,作为kafka消息头发送
+	Ack    func(err error)   //发送到kafka并被确认后调用,err为nil表示发送成功;不关心结果的输入为nil
+
+	Pipeline string                 //经过哪条处理链,是产生这条日志的小节名如taillog.nginx,为空时不处理
+	Body     map[string]interface{} //处理器解析出来的结构化字段,不为nil时发送json信封
+	Time     time.Time              //日志里的时间,不为零时作为kafka消息的时间戳,json信封里是@timestamp
+}
+
+// Truncate Data超过max字节时截断,不会截出半个utf-8字符,截断后Fields里加上truncated=true
+// max<=0表示不限制
+func (e *Event) Truncate(max int) {
+	if max <= 0 || len(e.Data) <= max {
+		return
+	}
+	n := max
+	for n > 0 && !utf8.RuneStart(e.Data[n]) {
+		n--
+	}
+	e.Data = e.Data[:n]
+	e.SetField("truncated", "true")
+}
+
+// SetField 设置一个元数据,Fields可能被同一批的多条日志共用,所以复制一份再改
+func (e *Event) SetField(key, value string) {
+	fields := make(map[string]string, len(e.Fields)+1)
+	for k, v := range e.Fields {
+		fields[k] = v
+	}
+	fields[key] = value
+	e.Fields = fields
+}
+
+// Payload 要发往kafka的消息内容
+func (e *Event) Payload() string {
+	if e.Body == nil && e.Time.IsZero() {
+		return e.Data
+	}
+	envelope := make(map[string]interface{}, len(e.Body)+2)
+	for k, v := range e.Body {
+		envelope[k] = v
+	}
+	envelope["message"] = e.Data
+	if !e.Time.IsZero() {
+		envelope["@timestamp"] = e.Time.UTC().Format(time.RFC3339Nano)
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false) //日志里常有<、>、&,不要转义
+	if err := enc.Encode(envelope); err != nil {
+		fmt.Println("marshal event body failed,err:", err)
+		return e.Data
+	}
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// Clone 复制一条日志,Body复制一层,处理器把一条拆成多条时用
+func (e *Event) Clone() *Event {
+	c := *e
+	if e.Body != nil {
+		c.Body = make(map[string]interface{}, len(e.Body))
+		for k, v := range e.Body {
+			c.Body[k] = v
+		}
+	}
+	return &c
+}
+
+// Get 按名字取一个字段:message是Data,其次是Body里解析出来的字段,最后是Fields
+// Body里没有这个名字时,kubernetes.pod.name这样的名字按嵌套的对象一层层找
+func (e *Event) Get(key string) (value string, ok bool) {
+	if key == "message" {
+		return e.Data, true
+	}
+	if v, found := lookup(e.Body, key); found {
+		return format(v), true
+	}
+	value, ok = e.Fields[key]
+	return
+}
+
+// lookup 先按整个key找,找不到时从左往右按.拆开,前一段是嵌套的对象时在里面找剩下的部分
+// 这样字段名本身带.(如grok提取出来的user.name)和json_decode解析出来的嵌套对象都能找到
+func lookup(obj map[string]interface{}, key string) (v interface{}, ok bool) {
+	if v, ok = obj[key]; ok {
+		return
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] != '.' {
+			continue
+		}
+		child, isObj := obj[key[:i]].(map[string]interface{})
+		if !isObj {
+			continue
+		}
+		if v, ok = lookup(child, key[i+1:]); ok {
+			return
+		}
+	}
+	return nil, false
+}
+
+// Set 设置一个解析出来的字段,message设置的是Data,其他的放到Body里
+func (e *Event) Set(key string, value interface{}) {
+	if key == "message" {
+		e.Data = format(value)
+		return
+	}
+	if e.Body == nil {
+		e.Body = make(map[string]interface{})
+	}
+	e.Body[key] = value
+}
+
+// format 字段值转成字符串,不是字符串的用紧凑的json表示
+func format(v interface{}) string {
+	switch s := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return s
+	case json.Number:
+		return s.String()
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return fmt.Sprint(v)
+	}
+	return strings.TrimSuffix(buf.String(), "\n")
+}
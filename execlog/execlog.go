@@ -0,0 +1,129 @@
+package execlog
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"test/conf"
+	"test/event"
+	"time"
+)
+
+//定时执行命令(如df -h、ss -s、自定义的检查脚本),把输出发到kafka
+//每个命令在自己的goroutine里按interval执行,上一次没结束时跳过这一次,所以不会重叠执行
+
+var logChan chan *event.Event
+
+// Init 为每个[exec.xxx]启动定时执行,没有配置命令时不启动
+func Init(entries []*conf.ExecEntry) (err error) {
+	if len(entries) == 0 {
+		return
+	}
+	for _, entry := range entries {
+		if entry.Command == "" {
+			return fmt.Errorf("exec.%s:command is empty", entry.Name)
+		}
+		if entry.Mode != "lines" && entry.Mode != "whole" {
+			return fmt.Errorf("exec.%s:invalid mode %q,must be lines or whole", entry.Name, entry.Mode)
+		}
+	}
+	logChan = make(chan *event.Event, 1000)
+	for _, entry := range entries {
+		go schedule(entry)
+	}
+	return
+}
+
+// ReadChan 没有配置命令时返回nil
+func ReadChan() <-chan *event.Event {
+	return logChan
+}
+
+// schedule 启动时先执行一次,之后每interval执行一次
+func schedule(entry *conf.ExecEntry) {
+	ticker := time.NewTicker(entry.Interval)
+	defer ticker.Stop()
+	for {
+		start := time.Now()
+		execute(entry)
+		//执行期间错过的tick直接丢掉,不补执行
+		select {
+		case <-ticker.C:
+			fmt.Printf("exec %s took %v,longer than interval %v,skip this run\n", entry.Name, time.Since(start), entry.Interval)
+		default:
+		}
+		<-ticker.C
+	}
+}
+
+// execute 执行一次命令,stdout和stderr合在一起作为输出
+func execute(entry *conf.ExecEntry) {
+	var out bytes.Buffer
+	cmd := command(entry.Command)
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+
+	fields := map[string]string{"command": entry.Name}
+	start := time.Now()
+	err := cmd.Start()
+	if err != nil {
+		fmt.Printf("exec %s failed,err:%v\n", entry.Name, err)
+		fields["exit_code"] = "-1"
+		fields["error"] = err.Error()
+	} else {
+		err = wait(cmd, entry.Timeout)
+		if err == errTimeout {
+			fmt.Printf("exec %s timeout after %v,killed\n", entry.Name, entry.Timeout)
+			fields["timeout"] = "true"
+		}
+		fields["exit_code"] = strconv.Itoa(cmd.ProcessState.ExitCode())
+	}
+	fields["duration_ms"] = strconv.FormatInt(int64(time.Since(start)/time.Millisecond), 10)
+
+	output := strings.TrimRight(out.String(), "\r\n")
+	if entry.Mode == "whole" {
+		//没有输出也发一条,这样exit_code能被收集到
+		ev := &event.Event{Topic: entry.Topic, Data: output, Fields: fields, Pipeline: "exec." + entry.Name}
+		ev.Truncate(entry.MaxBytes)
+		logChan <- ev
+		return
+	}
+	if output == "" {
+		return
+	}
+	for _, text := range strings.Split(output, "\n") {
+		ev := &event.Event{
+			Topic:    entry.Topic,
+			Data:     strings.TrimSuffix(text, "\r"),
+			Fields:   fields,
+			Pipeline: "exec." + entry.Name,
+		}
+		ev.Truncate(entry.MaxBytes)
+		logChan <- ev
+	}
+}
+
+var errTimeout = fmt.Errorf("timeout")
+
+// wait 等命令结束,超时时连同它启动的子进程一起杀掉,免得子进程继续占着输出管道
+func wait(cmd *exec.Cmd, timeout time.Duration) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+	if timeout <= 0 {
+		return <-done
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case err := <-done:
+		return err
+	case <-timer.C:
+		kill(cmd)
+		<-done
+		return errTimeout
+	}
+}
@@ -0,0 +1,21 @@
+//go:build !windows
+// +build !windows
+
+package execlog
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// command 用sh -c执行,命令在单独的进程组里运行,超时时可以连子进程一起杀掉
+func command(s string) *exec.Cmd {
+	cmd := exec.Command("sh", "-c", s)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	return cmd
+}
+
+// kill 杀掉命令所在的整个进程组
+func kill(cmd *exec.Cmd) {
+	syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
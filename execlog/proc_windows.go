@@ -0,0 +1,18 @@
+//go:build windows
+// +build windows
+
+package execlog
+
+import (
+	"os/exec"
+)
+
+// command 用cmd /C执行
+func command(s string) *exec.Cmd {
+	return exec.Command("cmd", "/C", s)
+}
+
+// kill windows下只能杀掉命令本身
+func kill(cmd *exec.Cmd) {
+	cmd.Process.Kill()
+}
@@ -6,7 +6,9 @@ require (
 	github.com/Shopify/sarama v1.27.2
 	github.com/fsnotify/fsnotify v1.4.7 // indirect
 	github.com/hpcloud/tail v1.0.0
-	gopkg.in/fsnotify.v1 v1.4.7 // indirect
+	github.com/klauspost/compress v1.11.0
+	golang.org/x/text v0.3.3
+	gopkg.in/fsnotify.v1 v1.4.7
 	gopkg.in/ini.v1 v1.62.0
 	gopkg.in/tomb.v1 v1.0.0-20141024135613-dd632973f1e7 // indirect
 )
@@ -0,0 +1,214 @@
+package httplog
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"test/conf"
+	"test/event"
+	"time"
+)
+
+//通过http接收日志:POST /ingest/{topic}
+//body可以是一个json对象、json数组或者每行一个json的ndjson,每个json作为一条消息发到topic
+//整批日志都被kafka确认后才返回200,队列放不下这一批时返回429,topic不在[http] topics里时返回403
+
+var (
+	cfg     conf.HTTPConf
+	lock    sync.Mutex //保证一批日志要么全部入队要么都不入队
+	logChan chan *event.Event
+)
+
+var topicPattern = regexp.MustCompile(`^[a-zA-Z0-9._-]{1,249}$`)
+
+// Init 监听address,address为空时不启动
+func Init(httpConf conf.HTTPConf) (err error) {
+	if httpConf.Address == "" {
+		return
+	}
+	cfg = httpConf
+	logChan = make(chan *event.Event, cfg.QueueSize)
+
+	l, err := net.Listen("tcp", cfg.Address)
+	if err != nil {
+		return
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ingest/", ingestHandler)
+	go func() {
+		err := http.Serve(l, mux)
+		fmt.Println("http ingest server exited,err:", err)
+	}()
+	return
+}
+
+// ReadChan 没有启动http输入时返回nil
+func ReadChan() <-chan *event.Event {
+	return logChan
+}
+
+func ingestHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		reply(w, http.StatusMethodNotAllowed, "only POST is allowed")
+		return
+	}
+	topic := strings.TrimPrefix(r.URL.Path, "/ingest/")
+	if !topicPattern.MatchString(topic) {
+		reply(w, http.StatusBadRequest, fmt.Sprintf("invalid topic %q", topic))
+		return
+	}
+	if !allowed(topic) {
+		reply(w, http.StatusForbidden, fmt.Sprintf("topic %q is not allowed", topic))
+		return
+	}
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, cfg.MaxBodySize))
+	if err != nil {
+		reply(w, http.StatusRequestEntityTooLarge, err.Error())
+		return
+	}
+	records, err := splitRecords(body)
+	if err != nil {
+		reply(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(records) == 0 {
+		reply(w, http.StatusOK, "")
+		return
+	}
+	if len(records) > cap(logChan) {
+		reply(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("batch of %d records exceeds queue_size %d", len(records), cap(logChan)))
+		return
+	}
+
+	acks := make(chan error, len(records))
+	fields := map[string]string{"peer": r.RemoteAddr}
+	if !enqueue(topic, records, fields, acks) {
+		w.Header().Set("Retry-After", "1")
+		reply(w, http.StatusTooManyRequests, "queue is full")
+		return
+	}
+
+	//等整批日志都被kafka确认
+	timeout := time.After(cfg.AckTimeout)
+	failed := 0
+	var lastErr error
+	for range records {
+		select {
+		case err := <-acks:
+			if err != nil {
+				failed++
+				lastErr = err
+			}
+		case <-timeout:
+			reply(w, http.StatusGatewayTimeout, "timeout waiting for kafka ack")
+			return
+		}
+	}
+	if failed > 0 {
+		reply(w, http.StatusInternalServerError, fmt.Sprintf("%d of %d records failed,last err:%v", failed, len(records), lastErr))
+		return
+	}
+	reply(w, http.StatusOK, "")
+}
+
+// allowed __开头的是kafka内部的topic(如__consumer_offsets),任何时候都不允许写
+// 配置了topics时只允许写匹配的topic
+func allowed(topic string) bool {
+	if strings.HasPrefix(topic, "__") {
+		return false
+	}
+	if len(cfg.Topics) == 0 {
+		return true
+	}
+	for _, pattern := range cfg.Topics {
+		if ok, _ := path.Match(strings.TrimSpace(pattern), topic); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// enqueue 队列剩余空间放不下整批日志时返回false
+func enqueue(topic string, records []string, fields map[string]string, acks chan error) bool {
+	lock.Lock()
+	defer lock.Unlock()
+	if cap(logChan)-len(logChan) < len(records) {
+		return false
+	}
+	ack := func(err error) {
+		acks <- err
+	}
+	for _, data := range records {
+		ev := &event.Event{
+			Topic:    topic,
+			Data:     data,
+			Fields:   fields,
+			Ack:      ack,
+			Pipeline: "http",
+		}
+		ev.Truncate(cfg.MaxBytes)
+		logChan <- ev
+	}
+	return true
+}
+
+// splitRecords body是json数组时每个元素是一条,是一个json对象时就是一条,否则每行一个json
+func splitRecords(body []byte) (records []string, err error) {
+	body = bytes.TrimSpace(body)
+	if len(body) > 0 && body[0] == '{' && json.Valid(body) {
+		return []string{compact(body)}, nil
+	}
+	if len(body) > 0 && body[0] == '[' {
+		var arr []json.RawMessage
+		err = json.Unmarshal(body, &arr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid json array:%v", err)
+		}
+		for _, raw := range arr {
+			records = append(records, compact(raw))
+		}
+		return
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(make([]byte, 64*1024), len(body)+1)
+	n := 0
+	for scanner.Scan() {
+		n++
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		if !json.Valid(line) {
+			return nil, fmt.Errorf("line %d is not valid json", n)
+		}
+		records = append(records, compact(line))
+	}
+	return records, scanner.Err()
+}
+
+func compact(raw []byte) string {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, raw); err != nil {
+		return string(raw)
+	}
+	return buf.String()
+}
+
+func reply(w http.ResponseWriter, code int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	resp := map[string]interface{}{"code": code}
+	if msg != "" {
+		resp["msg"] = msg
+	}
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,98 @@
+package importlog
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"test/event"
+	"test/logio"
+)
+
+//一次性导入历史日志:logagent import -topic x file1 file2 ...
+//按顺序把每个文件(或文件中的一段)读到结尾,全部发送并被kafka确认后Done()可读
+//.gz和.zst结尾的文件先解压,offset和length是解压后的字节数
+
+// Options 导入的参数
+type Options struct {
+	Topic    string
+	Offset   int64 //从每个文件的第几个字节开始读
+	Length   int64 //每个文件最多读多少字节,0表示读到结尾
+	MaxBytes int   //一行最多多少字节,超出的截断,0表示不限制
+}
+
+var batch *logio.Batch
+
+// Init 开始按顺序导入files
+func Init(files []string, opts Options) {
+	batch = logio.NewBatch()
+	go read(files, opts)
+}
+
+// ReadChan 没有启动导入时返回nil
+func ReadChan() <-chan *event.Event {
+	if batch == nil {
+		return nil
+	}
+	return batch.ReadChan()
+}
+
+// Done 没有启动导入时返回nil
+func Done() <-chan struct{} {
+	if batch == nil {
+		return nil
+	}
+	return batch.Done()
+}
+
+// Stats 一共读了多少行、多少字节,多少行发送失败或者多少个文件读取失败
+func Stats() (totalLines, totalBytes, fail int64) {
+	return batch.Stats()
+}
+
+func read(files []string, opts Options) {
+	for _, path := range files {
+		err := readFile(path, opts)
+		if err != nil {
+			fmt.Printf("import %s failed,err:%v\n", path, err)
+			batch.Fail()
+		}
+	}
+	batch.Close()
+}
+
+func readFile(path string, opts Options) (err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+	r, err := open(file, opts.Offset)
+	if err != nil {
+		return
+	}
+	defer r.Close()
+	var src io.Reader = r
+	if opts.Length > 0 {
+		src = io.LimitReader(r, opts.Length)
+	}
+	return batch.ReadLines(src, opts.Topic, map[string]string{"source": path}, opts.MaxBytes)
+}
+
+// open 按扩展名解压并跳到offset,没有压缩的文件直接seek
+func open(file *os.File, offset int64) (r io.ReadCloser, err error) {
+	if !logio.IsCompressed(file.Name()) {
+		_, err = file.Seek(offset, io.SeekStart)
+		return ioutil.NopCloser(file), err
+	}
+	r, err = logio.Decompress(file.Name(), file)
+	if err != nil || offset <= 0 {
+		return
+	}
+	_, err = io.CopyN(ioutil.Discard, r, offset)
+	if err != nil {
+		r.Close()
+		return nil, fmt.Errorf("skip to offset %d failed,err:%v", offset, err)
+	}
+	return
+}
@@ -3,6 +3,7 @@ package kafka
 import (
 	"fmt"
 	"github.com/Shopify/sarama"
+	"time"
 )
 
 //专门往kafka里面写日志的文件
@@ -16,6 +17,7 @@ func Init(addr []string) (err error) {
 	config.Producer.RequiredAcks = sarama.WaitForAll              //等待leader收到follower的ack，然后再收到leader的ack，这样很慢，需要follower从leader复制
 	config.Producer.Partitioner = sarama.NewRoundRobinPartitioner //轮训选出分区
 	config.Producer.Return.Successes = true                       //成功交付的消息将在success channel返回
+	config.Version = sarama.V0_11_0_0                             //消息头需要0.11以上的kafka
 
 	//连接kafka
 	client, err = sarama.NewSyncProducer(addr, config)
@@ -26,11 +28,25 @@ func Init(addr []string) (err error) {
 	return
 }
 
-func SendToKafka(topic, data string) {
+// Close 关闭生产者
+func Close() {
+	err := client.Close()
+	if err != nil {
+		fmt.Println("close producer failed,err:", err)
+	}
+}
+
+// SendToKafka 发送一条日志,fields作为消息头发送,返回时kafka已经确认收到
+// ts是日志里的时间,为零时由生产者用当前时间
+func SendToKafka(topic, data string, fields map[string]string, ts time.Time) (err error) {
 	//构造一个消息
 	msg := &sarama.ProducerMessage{}
 	msg.Topic = topic
 	msg.Value = sarama.StringEncoder(data)
+	msg.Timestamp = ts
+	for k, v := range fields {
+		msg.Headers = append(msg.Headers, sarama.RecordHeader{Key: []byte(k), Value: []byte(v)})
+	}
 
 	//发送消息
 	pid, offset, err := client.SendMessage(msg)
@@ -39,4 +55,5 @@ func SendToKafka(topic, data string) {
 		return
 	}
 	fmt.Printf("pid:%v offset:%v\n", pid, offset)
+	return
 }
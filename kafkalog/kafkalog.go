@@ -0,0 +1,176 @@
+package kafkalog
+
+import (
+	"context"
+	"fmt"
+	"github.com/Shopify/sarama"
+	"strings"
+	"test/conf"
+	"test/event"
+	"time"
+)
+
+//用消费组从kafka读日志,经过agent的处理后发到另一个topic(或另一个集群),用来把原始topic重新解析成结构化的topic
+//一条日志发送成功后才提交它的偏移,发送失败的会重发,所以重启或rebalance后可能重复但不会丢
+
+var logChan chan *event.Event
+
+// Init 为每个[consumer.xxx]启动一个消费组,没有配置时不启动
+func Init(entries []*conf.ConsumeEntry) (err error) {
+	if len(entries) == 0 {
+		return
+	}
+	groups := make([]sarama.ConsumerGroup, 0, len(entries))
+	for _, entry := range entries {
+		var group sarama.ConsumerGroup
+		group, err = newConsumerGroup(entry)
+		if err != nil {
+			for _, g := range groups {
+				g.Close()
+			}
+			return fmt.Errorf("consumer.%s:%v", entry.Name, err)
+		}
+		groups = append(groups, group)
+	}
+	logChan = make(chan *event.Event, 1000)
+	for i, entry := range entries {
+		go consume(groups[i], entry)
+	}
+	return
+}
+
+// ReadChan 没有配置消费组时返回nil
+func ReadChan() <-chan *event.Event {
+	return logChan
+}
+
+func newConsumerGroup(entry *conf.ConsumeEntry) (group sarama.ConsumerGroup, err error) {
+	if len(entry.Topics) == 0 {
+		return nil, fmt.Errorf("topics is empty")
+	}
+	config := sarama.NewConfig()
+	config.Version = sarama.V0_11_0_0 //消费组和消息头需要0.11以上的kafka
+	switch entry.InitialOffset {
+	case "oldest":
+		config.Consumer.Offsets.Initial = sarama.OffsetOldest
+	case "newest":
+		config.Consumer.Offsets.Initial = sarama.OffsetNewest
+	default:
+		return nil, fmt.Errorf("invalid initial_offset %q,must be oldest or newest", entry.InitialOffset)
+	}
+	return sarama.NewConsumerGroup(strings.Split(entry.Brokers, ","), entry.Group, config)
+}
+
+// consume Consume在rebalance时会返回,要循环调用
+func consume(group sarama.ConsumerGroup, entry *conf.ConsumeEntry) {
+	h := &handler{entry: entry}
+	for {
+		err := group.Consume(context.Background(), entry.Topics, h)
+		if err != nil {
+			fmt.Printf("consumer.%s consume failed,err:%v\n", entry.Name, err)
+			time.Sleep(time.Second)
+		}
+	}
+}
+
+// inflight 一条已经交出去还没确认的日志
+type inflight struct {
+	msg  *sarama.ConsumerMessage
+	ev   *event.Event
+	done chan error
+}
+
+type handler struct {
+	entry *conf.ConsumeEntry
+}
+
+func (h *handler) Setup(sarama.ConsumerGroupSession) error   { return nil }
+func (h *handler) Cleanup(sarama.ConsumerGroupSession) error { return nil }
+
+// ConsumeClaim 消费一个分区,另起一个goroutine按顺序等每条日志的确认,确认后才标记偏移
+func (h *handler) ConsumeClaim(sess sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	pending := make(chan *inflight, h.entry.MaxInflight)
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		for in := range pending {
+			if !h.wait(sess, in) {
+				return
+			}
+			sess.MarkMessage(in.msg, "")
+		}
+	}()
+	defer func() {
+		close(pending)
+		<-finished
+	}()
+
+	ctx := sess.Context()
+	for msg := range claim.Messages() {
+		in := h.newInflight(msg)
+		select {
+		case pending <- in:
+		case <-ctx.Done():
+			return nil
+		}
+		select {
+		case logChan <- in.ev:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+	return nil
+}
+
+func (h *handler) newInflight(msg *sarama.ConsumerMessage) *inflight {
+	in := &inflight{msg: msg, done: make(chan error, 1)}
+	in.ev = h.newEvent(in)
+	return in
+}
+
+// newEvent 用原始消息构造一条日志,重发时也要重新构造,因为处理链会修改发出去的那条
+func (h *handler) newEvent(in *inflight) *event.Event {
+	//原来的消息头原样带上
+	fields := make(map[string]string, len(in.msg.Headers))
+	for _, header := range in.msg.Headers {
+		fields[string(header.Key)] = string(header.Value)
+	}
+	ev := &event.Event{
+		Topic:  h.entry.Topic,
+		Data:   string(in.msg.Value),
+		Fields: fields,
+		Ack: func(err error) {
+			in.done <- err
+		},
+		Pipeline: "consumer." + h.entry.Name,
+	}
+	ev.Truncate(h.entry.MaxBytes)
+	return ev
+}
+
+// wait 等一条日志被确认,发送失败时隔一秒重发,返回false表示session已经结束
+func (h *handler) wait(sess sarama.ConsumerGroupSession, in *inflight) bool {
+	ctx := sess.Context()
+	for {
+		select {
+		case err := <-in.done:
+			if err == nil {
+				return true
+			}
+			fmt.Printf("consumer.%s send %s/%d/%d failed,retry,err:%v\n", h.entry.Name, in.msg.Topic, in.msg.Partition, in.msg.Offset, err)
+		case <-ctx.Done():
+			return false
+		}
+		select {
+		case <-time.After(time.Second):
+		case <-ctx.Done():
+			return false
+		}
+		in.ev = h.newEvent(in)
+		select {
+		case logChan <- in.ev:
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
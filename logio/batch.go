@@ -0,0 +1,91 @@
+package logio
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"test/event"
+)
+
+//stdin、import这种一次性的输入共用:按行读完,等所有日志都被kafka确认后Done()可读
+
+// Batch 一次性输入的发送通道和统计
+type Batch struct {
+	logChan chan *event.Event
+	done    chan struct{}
+	wg      sync.WaitGroup
+	lines   int64
+	bytes   int64
+	failed  int64
+}
+
+// NewBatch 创建一个Batch
+func NewBatch() *Batch {
+	return &Batch{
+		logChan: make(chan *event.Event, 1000),
+		done:    make(chan struct{}),
+	}
+}
+
+// ReadChan 读到的日志
+func (b *Batch) ReadChan() <-chan *event.Event {
+	return b.logChan
+}
+
+// Done Close之后,所有日志都被确认时可读
+func (b *Batch) Done() <-chan struct{} {
+	return b.done
+}
+
+// Stats 一共读了多少行、多少字节,失败了多少次
+func (b *Batch) Stats() (lines, bytes, failed int64) {
+	return atomic.LoadInt64(&b.lines), atomic.LoadInt64(&b.bytes), atomic.LoadInt64(&b.failed)
+}
+
+// Fail 记一次不是发送引起的失败,比如文件打不开
+func (b *Batch) Fail() {
+	atomic.AddInt64(&b.failed, 1)
+}
+
+// ReadLines 把r读到EOF,每行一条日志发到topic,超过maxBytes的行被截断
+// fields会加到每一条日志上,可以为nil
+func (b *Batch) ReadLines(r io.Reader, topic string, fields map[string]string, maxBytes int) error {
+	reader := bufio.NewReader(r)
+	for {
+		line, err := reader.ReadString('\n')
+		if line != "" {
+			b.wg.Add(1)
+			atomic.AddInt64(&b.lines, 1)
+			atomic.AddInt64(&b.bytes, int64(len(line)))
+			ev := &event.Event{
+				Topic:  topic,
+				Data:   strings.TrimRight(line, "\r\n"),
+				Fields: fields,
+				Ack:    b.ack,
+			}
+			ev.Truncate(maxBytes)
+			b.logChan <- ev
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Close 不会再有新的日志了,等所有日志都被确认后关闭Done()
+func (b *Batch) Close() {
+	b.wg.Wait()
+	close(b.done)
+}
+
+func (b *Batch) ack(err error) {
+	if err != nil {
+		b.Fail()
+	}
+	b.wg.Done()
+}
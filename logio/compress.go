@@ -0,0 +1,30 @@
+package logio
+
+import (
+	"compress/gzip"
+	"github.com/klauspost/compress/zstd"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+)
+
+// Decompress 按name的扩展名解压r,.gz和.zst以外的原样返回
+func Decompress(name string, r io.Reader) (io.ReadCloser, error) {
+	switch filepath.Ext(name) {
+	case ".gz":
+		return gzip.NewReader(r)
+	case ".zst":
+		d, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return d.IOReadCloser(), nil
+	}
+	return ioutil.NopCloser(r), nil
+}
+
+// IsCompressed name是不是Decompress能解压的文件
+func IsCompressed(name string) bool {
+	ext := filepath.Ext(name)
+	return ext == ".gz" || ext == ".zst"
+}
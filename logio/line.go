@@ -0,0 +1,33 @@
+package logio
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+)
+
+//tcp、syslog等按行接收日志的输入共用的读取函数
+
+// ReadLine 读到换行为止,返回的内容去掉了结尾的\r\n,超过max字节的部分丢弃
+// 没读到换行就出错时先返回已经读到的内容,错误留到下一次读的时候再返回
+func ReadLine(reader *bufio.Reader, max int) (line string, truncated bool, err error) {
+	var sb strings.Builder
+	for {
+		var chunk []byte
+		chunk, err = reader.ReadSlice('\n')
+		if sb.Len()+len(chunk) > max {
+			//丢掉的部分只有换行符时不算截断
+			keep := max - sb.Len()
+			truncated = truncated || len(bytes.TrimRight(chunk[keep:], "\r\n")) > 0
+			chunk = chunk[:keep]
+		}
+		sb.Write(chunk)
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err != nil && sb.Len() == 0 {
+			return
+		}
+		return strings.TrimRight(sb.String(), "\r\n"), truncated, nil
+	}
+}
@@ -1,55 +1,230 @@
 package main
 
 import (
+	"flag"
 	"fmt"
-	"gopkg.in/ini.v1"
+	"os"
 	"test/conf"
+	"test/event"
+	"test/execlog"
+	"test/httplog"
+	"test/importlog"
 	"test/kafka"
+	"test/kafkalog"
+	"test/processor"
+	"test/stdinlog"
+	"test/syslog"
 	"test/taillog"
+	"test/tcplog"
 	"time"
 )
 
 var (
 	cfg *conf.AppConf=new(conf.AppConf)
+
+	configFile = flag.String("config", "./conf/config.ini", "配置文件路径")
+	stdinMode  = flag.Bool("stdin", false, "从标准输入读日志,读完并且全部被kafka确认后退出")
+	topic      = flag.String("topic", "", "stdin模式下发往的topic,默认用配置文件中kafka的topic")
+	kafkaAddr  = flag.String("kafka", "", "kafka地址,覆盖配置文件中kafka的address")
+	maxBytes   = flag.Int("max-bytes", 512*1024, "stdin模式下一行最多多少字节,超出的截断,0表示不限制")
 )
 
 func run() {
-	//1.读取日志
+	//1.读取日志,没有启动的输入ReadChan返回nil,select不会选中
 	for {
 		select {
-		case line := <-taillog.ReadChan():
-			//2/发送到kafka
-			kafka.SendToKafka(cfg.KafkaConf.Topic, line.Text)
+		case ev := <-taillog.ReadChan():
+			send(ev)
+		case ev := <-syslog.ReadChan():
+			send(ev)
+		case ev := <-tcplog.ReadChan():
+			send(ev)
+		case ev := <-httplog.ReadChan():
+			send(ev)
+		case ev := <-execlog.ReadChan():
+			send(ev)
+		case ev := <-kafkalog.ReadChan():
+			send(ev)
+		case ev := <-stdinlog.ReadChan():
+			send(ev)
+		case <-stdinlog.Done():
+			return
+		case ev := <-importlog.ReadChan():
+			send(ev)
+		case <-importlog.Done():
+			return
 		default:
 			time.Sleep(time.Second)
 		}
 	}
 }
 
+//2.经过所属收集项配置的处理器,再发送到对应的topic,等待确认的输入通过Ack拿到结果
+func send(ev *event.Event) {
+	for _, e := range processor.Run(ev) {
+		err := kafka.SendToKafka(e.Topic, e.Payload(), e.Fields, e.Time)
+		if e.Ack != nil {
+			e.Ack(err)
+		}
+	}
+}
+
 //logagent程序入口
 func main() {
-	//0.加载配置文件
-	err := ini.MapTo(cfg, "./conf/config.ini")
-	if err != nil {
+	if len(os.Args) > 1 && os.Args[1] == "import" {
+		os.Exit(runImport(os.Args[2:]))
+	}
+	flag.Parse()
+
+	//0.加载配置文件,stdin模式下通过-kafka指定了地址时可以没有配置文件
+	err := conf.Load(*configFile, cfg)
+	if err != nil && !(*stdinMode && *kafkaAddr != "" && os.IsNotExist(err)) {
 		fmt.Printf("load ini failed,err:%v\n", err)
+		exitIfStdin()
 		return
 	}
+	if *kafkaAddr != "" {
+		cfg.KafkaConf.Address = *kafkaAddr
+	}
 
 	//1.初始化kafka连接
 	err = kafka.Init([]string{cfg.KafkaConf.Address})
 	if err != nil {
 		fmt.Println("init kafka failed,err:", err)
+		exitIfStdin()
 		return
 	}
 	fmt.Println("init kafka success")
 
+	if *stdinMode {
+		os.Exit(runStdin())
+	}
+
+	//创建每个收集项的处理链
+	err = processor.Init(cfg)
+	if err != nil {
+		fmt.Println("init processors failed,err:", err)
+		return
+	}
+
 	//2.打开日志文件准备收集日志
-	err = taillog.Init(cfg.LogConf.FileName)
+	err = taillog.Init(cfg)
 	if err != nil {
 		fmt.Println("open file failed,err:", err)
 		return
 	}
 	fmt.Println("init tail log success")
 
+	//3.启动syslog监听
+	err = syslog.Init(cfg.SyslogConf)
+	if err != nil {
+		fmt.Println("init syslog failed,err:", err)
+		return
+	}
+
+	//4.启动tcp输入
+	err = tcplog.Init(cfg.TCPConf)
+	if err != nil {
+		fmt.Println("init tcp input failed,err:", err)
+		return
+	}
+
+	//5.启动http输入
+	err = httplog.Init(cfg.HTTPConf)
+	if err != nil {
+		fmt.Println("init http input failed,err:", err)
+		return
+	}
+
+	//6.启动定时执行的命令
+	err = execlog.Init(cfg.ExecEntries)
+	if err != nil {
+		fmt.Println("init exec input failed,err:", err)
+		return
+	}
+
+	//7.启动kafka消费组
+	err = kafkalog.Init(cfg.ConsumeEntries)
+	if err != nil {
+		fmt.Println("init kafka consumer failed,err:", err)
+		return
+	}
+
 	run()
 }
+
+// runStdin 只从标准输入收集,读完并且全部被确认后返回退出码
+func runStdin() int {
+	t := *topic
+	if t == "" {
+		t = cfg.KafkaConf.Topic
+	}
+	stdinlog.Init(os.Stdin, t, *maxBytes)
+	run()
+	kafka.Close()
+
+	total, failed := stdinlog.Stats()
+	fmt.Fprintf(os.Stderr, "stdin: %d lines,%d failed\n", total, failed)
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// exitIfStdin stdin模式下一般接在管道后面,出错时返回1,让调用方知道日志没有发出去
+func exitIfStdin() {
+	if *stdinMode {
+		os.Exit(1)
+	}
+}
+
+// runImport logagent import -topic x file1 file2 ...
+// 把文件读到结尾,全部被确认后打印汇总,有失败时返回1
+func runImport(args []string) int {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	configFile := fs.String("config", "./conf/config.ini", "配置文件路径")
+	kafkaAddr := fs.String("kafka", "", "kafka地址,覆盖配置文件中kafka的address")
+	var opts importlog.Options
+	fs.StringVar(&opts.Topic, "topic", "", "发往的topic,默认用配置文件中kafka的topic")
+	fs.Int64Var(&opts.Offset, "offset", 0, "从每个文件的第几个字节开始读,压缩文件是解压后的字节数")
+	fs.Int64Var(&opts.Length, "length", 0, "每个文件最多读多少字节,0表示读到结尾")
+	fs.IntVar(&opts.MaxBytes, "max-bytes", 512*1024, "一行最多多少字节,超出的截断,0表示不限制")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: logagent import [flags] file1 file2 ...")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	//通过-kafka指定了地址时可以没有配置文件
+	err := conf.Load(*configFile, cfg)
+	if err != nil && !(*kafkaAddr != "" && os.IsNotExist(err)) {
+		fmt.Fprintf(os.Stderr, "load ini failed,err:%v\n", err)
+		return 1
+	}
+	if *kafkaAddr != "" {
+		cfg.KafkaConf.Address = *kafkaAddr
+	}
+	if opts.Topic == "" {
+		opts.Topic = cfg.KafkaConf.Topic
+	}
+	err = kafka.Init([]string{cfg.KafkaConf.Address})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "init kafka failed,err:", err)
+		return 1
+	}
+
+	importlog.Init(fs.Args(), opts)
+	run()
+	kafka.Close()
+
+	lines, bytes, failed := importlog.Stats()
+	fmt.Fprintf(os.Stderr, "import: %d files,%d lines,%d bytes,%d failed\n", fs.NArg(), lines, bytes, failed)
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
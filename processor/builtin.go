@@ -0,0 +1,67 @@
+package processor
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"test/event"
+)
+
+//内置的处理器
+//  add_fields:给日志加上固定的字段,小节里每个配置项是一个字段,比如env=prod
+//  split:按separator把一条日志拆成多条,空的部分丢掉
+
+func init() {
+	Register("add_fields", newAddFields)
+	Register("split", newSplit)
+}
+
+type addFields struct {
+	fields map[string]string
+}
+
+func newAddFields(options map[string]string) (Processor, error) {
+	if len(options) == 0 {
+		return nil, fmt.Errorf("no fields to add")
+	}
+	return &addFields{fields: options}, nil
+}
+
+func (p *addFields) Process(ev *event.Event) []*event.Event {
+	for k, v := range p.fields {
+		ev.SetField(k, v)
+	}
+	return []*event.Event{ev}
+}
+
+type split struct {
+	separator string
+}
+
+// newSplit separator可以写\n、\t这样的转义,默认是\n
+func newSplit(options map[string]string) (Processor, error) {
+	sep, ok := options["separator"]
+	if !ok {
+		sep = `\n`
+	}
+	sep, err := strconv.Unquote(`"` + strings.Replace(sep, `"`, `\"`, -1) + `"`)
+	if err != nil {
+		return nil, fmt.Errorf("invalid separator %q,err:%v", options["separator"], err)
+	}
+	if sep == "" {
+		return nil, fmt.Errorf("separator is empty")
+	}
+	return &split{separator: sep}, nil
+}
+
+func (p *split) Process(ev *event.Event) (events []*event.Event) {
+	for _, part := range strings.Split(ev.Data, p.separator) {
+		if part == "" {
+			continue
+		}
+		e := ev.Clone()
+		e.Data = part
+		events = append(events, e)
+	}
+	return
+}
@@ -0,0 +1,92 @@
+package processor
+
+import (
+	"fmt"
+	"strings"
+	"test/condition"
+	"test/event"
+)
+
+//filter:按条件过滤日志,条件的写法见condition包,比如 level in ["DEBUG","TRACE"] && path =~ "healthz"
+//  condition:条件表达式
+//  action:drop丢掉满足条件的日志(默认),keep只留下满足条件的日志,tag给满足条件的日志加上标签
+//  tag:action=tag时加的标签,多个用逗号分隔,放在json信封的tags数组里
+
+func init() {
+	Register("filter", newFilter)
+}
+
+type filter struct {
+	cond   *condition.Condition
+	action string
+	tags   []string
+}
+
+func newFilter(options map[string]string) (Processor, error) {
+	expr := strings.TrimSpace(options["condition"])
+	if expr == "" {
+		return nil, fmt.Errorf("condition is empty")
+	}
+	cond, err := condition.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	p := &filter{cond: cond, action: strings.TrimSpace(options["action"])}
+	switch p.action {
+	case "":
+		p.action = "drop"
+	case "drop", "keep":
+	case "tag":
+		for _, tag := range strings.Split(options["tag"], ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				p.tags = append(p.tags, tag)
+			}
+		}
+		if len(p.tags) == 0 {
+			return nil, fmt.Errorf("tag is empty")
+		}
+	default:
+		return nil, fmt.Errorf("invalid action %q,must be drop, keep or tag", p.action)
+	}
+	return p, nil
+}
+
+func (p *filter) Process(ev *event.Event) []*event.Event {
+	matched := p.cond.Match(ev)
+	switch p.action {
+	case "drop":
+		if matched {
+			return nil
+		}
+	case "keep":
+		if !matched {
+			return nil
+		}
+	case "tag":
+		if matched {
+			addTags(ev, p.tags)
+		}
+	}
+	return []*event.Event{ev}
+}
+
+// addTags 加到Body的tags里,json_decode解析出来的tags也是数组,重复的不加
+func addTags(ev *event.Event, tags []string) {
+	var list []interface{}
+	seen := make(map[string]bool)
+	if old, ok := ev.Body["tags"].([]interface{}); ok {
+		for _, t := range old {
+			list = append(list, t)
+			if s, ok := t.(string); ok {
+				seen[s] = true
+			}
+		}
+	}
+	for _, tag := range tags {
+		if !seen[tag] {
+			seen[tag] = true
+			list = append(list, tag)
+		}
+	}
+	ev.Set("tags", list)
+}
@@ -0,0 +1,292 @@
+package processor
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"test/event"
+	"time"
+)
+
+//grok:用%{IP:client} %{WORD:method} %{URIPATH:path}这样的模式从文本日志里提取字段,放到Body里
+//  field:从哪个字段提取,默认message
+//  pattern、pattern2、pattern3...:按顺序尝试,用第一个匹配上的,%{NUMBER:bytes:int}可以转成int或float
+//  pattern_files:自己定义的模式文件,每行是"名字 正则",#开头是注释,可以用通配符,多个用逗号分隔,同名的覆盖内置模式
+//提取出来的message会替换原来的日志内容;所有模式都不匹配时加上parse_error字段,日志照常发送
+//每个收集项匹配失败的次数每分钟打印一次,也可以用GrokFailures取
+
+func init() {
+	Register("grok", newGrok)
+}
+
+// grokRef %{名字}、%{名字:字段}或%{名字:字段:类型}
+// grokNamed 模式文件里也可以直接写(?<字段>...)或(?P<字段>...)
+var (
+	grokRef   = regexp.MustCompile(`%\{(\w+)(?::([^:}]+))?(?::(\w+))?\}`)
+	grokNamed = regexp.MustCompile(`\(\?P?<([^>]+)>`)
+)
+
+// grokReportInterval 多久打印一次匹配失败的次数
+const grokReportInterval = time.Minute
+
+type grokCapture struct {
+	field string
+	typ   string //int、float,为空时是字符串
+}
+
+type grokPattern struct {
+	text     string
+	re       *regexp.Regexp
+	captures map[int]grokCapture //key为子匹配的序号
+}
+
+type grok struct {
+	field    string
+	patterns []*grokPattern
+}
+
+func newGrok(options map[string]string) (Processor, error) {
+	p := &grok{field: "message"}
+	if s, ok := options["field"]; ok {
+		p.field = strings.TrimSpace(s)
+	}
+	if p.field == "" {
+		return nil, fmt.Errorf("field is empty")
+	}
+	defs := make(map[string]string, len(builtinPatterns))
+	for name, def := range builtinPatterns {
+		defs[name] = def
+	}
+	for _, s := range strings.Split(options["pattern_files"], ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		if err := loadPatternFiles(s, defs); err != nil {
+			return nil, err
+		}
+	}
+	texts, err := numberedOptions(options, "pattern")
+	if err != nil {
+		return nil, err
+	}
+	for _, text := range texts {
+		gp, err := compileGrok(text, defs)
+		if err != nil {
+			return nil, fmt.Errorf("compile pattern %q failed,err:%v", text, err)
+		}
+		p.patterns = append(p.patterns, gp)
+	}
+	return p, nil
+}
+
+// loadPatternFiles 读取pattern通配到的模式文件
+func loadPatternFiles(pattern string, defs map[string]string) error {
+	files, err := filepath.Glob(pattern)
+	if err != nil {
+		return fmt.Errorf("invalid pattern_files %q,err:%v", pattern, err)
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("pattern file %q not found", pattern)
+	}
+	for _, name := range files {
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		scanner := bufio.NewScanner(f)
+		n := 0
+		for scanner.Scan() {
+			n++
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			i := strings.IndexAny(line, " \t")
+			if i < 0 {
+				f.Close()
+				return fmt.Errorf("%s:%d:pattern has no definition", name, n)
+			}
+			defs[line[:i]] = strings.TrimSpace(line[i+1:])
+		}
+		err = scanner.Err()
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("read pattern file %s failed,err:%v", name, err)
+		}
+	}
+	return nil
+}
+
+// compileGrok 把%{...}展开成正则,要提取的字段换成g0、g1...这样的子匹配名,字段名里可以有.、@这些正则不允许的字符
+func compileGrok(text string, defs map[string]string) (gp *grokPattern, err error) {
+	var captures []grokCapture
+	var expand func(s string, depth int) string
+	expand = func(s string, depth int) string {
+		if depth > 32 {
+			err = fmt.Errorf("patterns nested too deep,maybe recursive")
+			return ""
+		}
+		s = grokNamed.ReplaceAllStringFunc(s, func(ref string) string {
+			captures = append(captures, grokCapture{field: grokNamed.FindStringSubmatch(ref)[1]})
+			return fmt.Sprintf("(?P<g%d>", len(captures)-1)
+		})
+		return grokRef.ReplaceAllStringFunc(s, func(ref string) string {
+			if err != nil {
+				return ""
+			}
+			m := grokRef.FindStringSubmatch(ref)
+			def, ok := defs[m[1]]
+			if !ok {
+				err = fmt.Errorf("pattern %%{%s} not found", m[1])
+				return ""
+			}
+			if m[2] == "" {
+				return "(?:" + expand(def, depth+1) + ")"
+			}
+			if m[3] != "" && m[3] != "int" && m[3] != "float" {
+				err = fmt.Errorf("invalid type %q in %s,must be int or float", m[3], ref)
+				return ""
+			}
+			captures = append(captures, grokCapture{field: m[2], typ: m[3]})
+			group := fmt.Sprintf("(?P<g%d>", len(captures)-1)
+			return group + expand(def, depth+1) + ")"
+		})
+	}
+	expanded := expand(text, 0)
+	if err != nil {
+		return
+	}
+	re, err := regexp.Compile(expanded)
+	if err != nil {
+		return
+	}
+	gp = &grokPattern{text: text, re: re, captures: make(map[int]grokCapture)}
+	for i, name := range re.SubexpNames() {
+		if !strings.HasPrefix(name, "g") {
+			continue
+		}
+		if n, err := strconv.Atoi(name[1:]); err == nil && n < len(captures) {
+			gp.captures[i] = captures[n]
+		}
+	}
+	return
+}
+
+func (p *grok) Process(ev *event.Event) []*event.Event {
+	src, ok := ev.Get(p.field)
+	if !ok {
+		ev.Set("parse_error", fmt.Sprintf("field %q not found", p.field))
+		countGrok(ev.Pipeline, false)
+		return []*event.Event{ev}
+	}
+	for _, gp := range p.patterns {
+		m := gp.re.FindStringSubmatchIndex(src)
+		if m == nil {
+			continue
+		}
+		//同一个字段可能出现在几个分支里,用匹配上的那个
+		values := make(map[string]interface{})
+		for i, c := range gp.captures {
+			if m[2*i] < 0 {
+				continue
+			}
+			if _, ok := values[c.field]; ok {
+				continue
+			}
+			values[c.field] = convert(src[m[2*i]:m[2*i+1]], c.typ)
+		}
+		for field, v := range values {
+			ev.Set(field, v)
+		}
+		countGrok(ev.Pipeline, true)
+		return []*event.Event{ev}
+	}
+	ev.Set("parse_error", "no grok pattern matched")
+	countGrok(ev.Pipeline, false)
+	return []*event.Event{ev}
+}
+
+// convert 转换失败时保留原来的字符串
+func convert(s, typ string) interface{} {
+	switch typ {
+	case "int":
+		if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return n
+		}
+	case "float":
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return f
+		}
+	}
+	return s
+}
+
+// grokCounter 一个收集项经过grok的日志数
+type grokCounter struct {
+	total    int64
+	failed   int64
+	reported int64 //上次打印时的failed
+}
+
+var (
+	grokLock   sync.Mutex
+	grokStats  = make(map[string]*grokCounter) //key为event.Pipeline
+	grokReport sync.Once
+)
+
+func countGrok(pipeline string, matched bool) {
+	grokReport.Do(func() {
+		go reportGrok()
+	})
+	grokLock.Lock()
+	defer grokLock.Unlock()
+	c, ok := grokStats[pipeline]
+	if !ok {
+		c = &grokCounter{}
+		grokStats[pipeline] = c
+	}
+	c.total++
+	if !matched {
+		c.failed++
+	}
+}
+
+// GrokFailures 每个收集项一共有多少条日志没有匹配上grok模式,key为taillog.nginx这样的处理链名
+func GrokFailures() map[string]int64 {
+	grokLock.Lock()
+	defer grokLock.Unlock()
+	failures := make(map[string]int64, len(grokStats))
+	for pipeline, c := range grokStats {
+		failures[pipeline] = c.failed
+	}
+	return failures
+}
+
+// reportGrok 定时打印新增了匹配失败的收集项
+func reportGrok() {
+	ticker := time.NewTicker(grokReportInterval)
+	for range ticker.C {
+		grokLock.Lock()
+		var pipelines []string
+		for pipeline := range grokStats {
+			pipelines = append(pipelines, pipeline)
+		}
+		sort.Strings(pipelines)
+		for _, pipeline := range pipelines {
+			c := grokStats[pipeline]
+			if c.failed == c.reported {
+				continue
+			}
+			fmt.Printf("grok %s:%d events matched no pattern in the last %v,%d of %d in total\n", pipeline, c.failed-c.reported, grokReportInterval, c.failed, c.total)
+			c.reported = c.failed
+		}
+		grokLock.Unlock()
+	}
+}
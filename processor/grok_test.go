@@ -0,0 +1,149 @@
+package processor
+
+import (
+	"reflect"
+	"strings"
+	"test/event"
+	"testing"
+)
+
+// grokSamples 每个内置模式一个能完整匹配的例子,加内置模式时也要加上
+var grokSamples = map[string]string{
+	"USERNAME":          "john.doe-1",
+	"USER":              "www_data",
+	"EMAILLOCALPART":    "john.doe+tag",
+	"EMAILADDRESS":      "john.doe@example.com",
+	"HTTPDUSER":         "john@example.com",
+	"INT":               "-42",
+	"BASE10NUM":         "+3.14",
+	"NUMBER":            "-3.5",
+	"BASE16NUM":         "0x1aF",
+	"POSINT":            "8080",
+	"NONNEGINT":         "0",
+	"WORD":              "hello_1",
+	"NOTSPACE":          "a/b?c=d",
+	"SPACE":             " \t",
+	"DATA":              "any thing",
+	"GREEDYDATA":        "any thing at all",
+	"QUOTEDSTRING":      `"say \"hi\""`,
+	"QS":                `'single'`,
+	"UUID":              "123e4567-e89b-12d3-a456-426614174000",
+	"CISCOMAC":          "0123.4567.89ab",
+	"WINDOWSMAC":        "01-23-45-67-89-AB",
+	"COMMONMAC":         "01:23:45:67:89:ab",
+	"MAC":               "01:23:45:67:89:ab",
+	"IPV4":              "192.168.1.10",
+	"IPV6":              "2001:db8::1",
+	"IP":                "::1",
+	"HOSTNAME":          "web-01.example.com",
+	"IPORHOST":          "10.0.0.1",
+	"HOSTPORT":          "example.com:443",
+	"UNIXPATH":          "/var/log/app.log",
+	"WINPATH":           `C:\logs\app.log`,
+	"PATH":              "/tmp/x",
+	"URIPROTO":          "https",
+	"URIHOST":           "example.com:8080",
+	"URIPATH":           "/api/v1/users",
+	"URIPARAM":          "?id=1&name=x",
+	"URIPATHPARAM":      "/search?q=go",
+	"URI":               "https://user@example.com:8443/a/b?c=d",
+	"MONTH":             "Sep",
+	"MONTHNUM":          "09",
+	"MONTHNUM2":         "12",
+	"MONTHDAY":          "31",
+	"DAY":               "Monday",
+	"YEAR":              "2024",
+	"HOUR":              "23",
+	"MINUTE":            "59",
+	"SECOND":            "60",
+	"TIME":              "12:34:56",
+	"DATE_US":           "12/31/2024",
+	"DATE_EU":           "31.12.2024",
+	"DATE":              "31-12-2024",
+	"DATESTAMP":         "31.12.2024 12:34:56",
+	"TZ":                "CST",
+	"ISO8601_TIMEZONE":  "+08:00",
+	"TIMESTAMP_ISO8601": "2024-12-31T12:34:56.789+08:00",
+	"DATESTAMP_RFC822":  "Mon Dec 31 2024 12:34:56 UTC",
+	"DATESTAMP_RFC2822": "Mon, 31 Dec 2024 12:34:56 +0800",
+	"DATESTAMP_OTHER":   "Mon Dec 31 12:34:56 UTC 2024",
+	"HTTPDATE":          "31/Dec/2024:12:34:56 +0800",
+	"SYSLOGTIMESTAMP":   "Dec  1 12:34:56",
+	"LOGLEVEL":          "WARN",
+	"PROG":              "sshd",
+	"SYSLOGPROG":        "sshd[123]",
+	"SYSLOGHOST":        "web-01",
+	"SYSLOGFACILITY":    "<4.2>",
+	"SYSLOGBASE":        "Dec  1 12:34:56 <4.2> web-01 sshd[123]:",
+	"SYSLOGLINE":        "Dec  1 12:34:56 web-01 sshd[123]: Accepted publickey",
+	"COMMONAPACHELOG":   `127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif HTTP/1.0" 200 2326`,
+	"COMBINEDAPACHELOG": `127.0.0.1 - - [10/Oct/2000:13:55:36 -0700] "GET / HTTP/1.1" 304 - "http://example.com/" "Mozilla/5.0"`,
+}
+
+func TestBuiltinPatterns(t *testing.T) {
+	for name := range builtinPatterns {
+		gp, err := compileGrok("^%{"+name+"}$", builtinPatterns)
+		if err != nil {
+			t.Errorf("compile %%{%s} failed,err:%v", name, err)
+			continue
+		}
+		sample, ok := grokSamples[name]
+		if !ok {
+			t.Errorf("no sample for %%{%s}", name)
+			continue
+		}
+		if !gp.re.MatchString(sample) {
+			t.Errorf("%%{%s} does not match %q", name, sample)
+		}
+	}
+	for name := range grokSamples {
+		if _, ok := builtinPatterns[name]; !ok {
+			t.Errorf("sample for unknown pattern %%{%s}", name)
+		}
+	}
+}
+
+func TestCompileGrok(t *testing.T) {
+	defs := map[string]string{
+		"NUM":   `\d+`,
+		"PAIR":  `%{NUM:a}-%{NUM:b}`,
+		"LOOP":  `%{LOOP}`,
+		"NAMED": `(?<user.name>\w+)`,
+	}
+	tests := []struct {
+		text    string
+		input   string
+		want    map[string]interface{}
+		wantErr string
+	}{
+		{text: `%{NUM:n}`, input: "42", want: map[string]interface{}{"n": "42"}},
+		{text: `%{NUM:n:int}`, input: "42", want: map[string]interface{}{"n": int64(42)}},
+		{text: `%{NUM:n:float}`, input: "42", want: map[string]interface{}{"n": float64(42)}},
+		{text: `%{NUM}-%{NUM:n}`, input: "1-2", want: map[string]interface{}{"n": "2"}},
+		{text: `%{PAIR:p}`, input: "1-2", want: map[string]interface{}{"p": "1-2", "a": "1", "b": "2"}},
+		{text: `%{NAMED} %{NUM:@status}`, input: "bob 7", want: map[string]interface{}{"user.name": "bob", "@status": "7"}},
+		{text: `(?:a=%{NUM:n}|b=%{NUM:n})`, input: "b=3", want: map[string]interface{}{"n": "3"}},
+		{text: `%{MISSING:x}`, wantErr: "pattern %{MISSING} not found"},
+		{text: `%{NUM:n:bool}`, wantErr: `invalid type "bool"`},
+		{text: `%{LOOP}`, wantErr: "nested too deep"},
+		{text: `%{NUM:n}(`, wantErr: "missing closing )"},
+	}
+	for _, tt := range tests {
+		gp, err := compileGrok(tt.text, defs)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("compileGrok(%q) err = %v, want %q", tt.text, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("compileGrok(%q) err = %v", tt.text, err)
+			continue
+		}
+		ev := &event.Event{Data: tt.input}
+		(&grok{field: "message", patterns: []*grokPattern{gp}}).Process(ev)
+		if !reflect.DeepEqual(ev.Body, tt.want) {
+			t.Errorf("grok %q on %q = %v, want %v", tt.text, tt.input, ev.Body, tt.want)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package processor
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"test/event"
+)
+
+//json_decode:把json格式的日志解析成字段放到Body里,发到kafka的是{"message":...,字段...}
+//  message_key:哪个字段作为message,默认message,没有这个字段时message保留原来的整行日志
+//  promote:把嵌套的字段提到最外层,如kubernetes.pod.name,写成kubernetes.pod.name:pod可以改名,多个用逗号分隔
+//不是json对象的日志原样作为message,加上parse_error字段说明原因,不会丢掉
+
+func init() {
+	Register("json_decode", newJSONDecode)
+}
+
+type promotion struct {
+	path []string //嵌套字段的路径
+	name string   //提到最外层后的名字
+}
+
+type jsonDecode struct {
+	messageKey string
+	promotes   []promotion
+}
+
+func newJSONDecode(options map[string]string) (Processor, error) {
+	p := &jsonDecode{messageKey: "message"}
+	if s, ok := options["message_key"]; ok {
+		p.messageKey = strings.TrimSpace(s)
+	}
+	if p.messageKey == "" {
+		return nil, fmt.Errorf("message_key is empty")
+	}
+	for _, s := range strings.Split(options["promote"], ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		pr := promotion{}
+		if i := strings.LastIndex(s, ":"); i >= 0 {
+			pr.name = strings.TrimSpace(s[i+1:])
+			s = strings.TrimSpace(s[:i])
+		}
+		pr.path = strings.Split(s, ".")
+		for _, seg := range pr.path {
+			if seg == "" {
+				return nil, fmt.Errorf("invalid promote path %q", s)
+			}
+		}
+		if pr.name == "" {
+			pr.name = pr.path[len(pr.path)-1]
+		}
+		p.promotes = append(p.promotes, pr)
+	}
+	return p, nil
+}
+
+func (p *jsonDecode) Process(ev *event.Event) []*event.Event {
+	if ev.Body == nil {
+		ev.Body = make(map[string]interface{})
+	}
+	dec := json.NewDecoder(strings.NewReader(ev.Data))
+	dec.UseNumber() //保留原来的数字,大整数不会变成浮点数
+	var obj map[string]interface{}
+	err := dec.Decode(&obj)
+	if err == nil && dec.More() {
+		err = fmt.Errorf("unexpected data after json object")
+	}
+	if err == nil && obj == nil {
+		err = fmt.Errorf("not a json object")
+	}
+	if err != nil {
+		ev.Body["parse_error"] = err.Error()
+		return []*event.Event{ev}
+	}
+
+	for _, pr := range p.promotes {
+		if v, ok := take(obj, pr.path); ok {
+			obj[pr.name] = v
+		}
+	}
+	msg, hasMsg := obj[p.messageKey]
+	delete(obj, p.messageKey)
+	for k, v := range obj {
+		ev.Body[k] = v
+	}
+	if hasMsg {
+		ev.Set("message", msg)
+	}
+	return []*event.Event{ev}
+}
+
+// take 取出嵌套的字段,取完后变空的上层对象也去掉
+func take(obj map[string]interface{}, path []string) (v interface{}, ok bool) {
+	v, ok = obj[path[0]]
+	if !ok || len(path) == 1 {
+		delete(obj, path[0])
+		return
+	}
+	child, isObj := v.(map[string]interface{})
+	if !isObj {
+		return nil, false
+	}
+	v, ok = take(child, path[1:])
+	if ok && len(child) == 0 {
+		delete(obj, path[0])
+	}
+	return
+}
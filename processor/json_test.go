@@ -0,0 +1,73 @@
+package processor
+
+import (
+	"encoding/json"
+	"reflect"
+	"test/event"
+	"testing"
+)
+
+func TestJSONDecode(t *testing.T) {
+	tests := []struct {
+		name    string
+		options map[string]string
+		data    string
+		message string
+		body    map[string]interface{}
+	}{
+		{
+			name:    "message key",
+			data:    `{"message":"hello","level":"INFO"}`,
+			message: "hello",
+			body:    map[string]interface{}{"level": "INFO"},
+		},
+		{
+			name:    "custom message key",
+			options: map[string]string{"message_key": "msg"},
+			data:    `{"msg":"hello","n":1}`,
+			message: "hello",
+			body:    map[string]interface{}{"n": json.Number("1")},
+		},
+		{
+			name:    "missing message key keeps the line",
+			data:    `{"level":"INFO"}`,
+			message: `{"level":"INFO"}`,
+			body:    map[string]interface{}{"level": "INFO"},
+		},
+		{
+			name:    "promote",
+			options: map[string]string{"promote": "k8s.pod.name:pod"},
+			data:    `{"message":"hi","k8s":{"pod":{"name":"web-1"}}}`,
+			message: "hi",
+			body:    map[string]interface{}{"pod": "web-1"},
+		},
+		{
+			name:    "not an object",
+			data:    `null`,
+			message: `null`,
+			body:    map[string]interface{}{"parse_error": "not a json object"},
+		},
+		{
+			name:    "trailing data",
+			data:    `{"message":"a"} x`,
+			message: `{"message":"a"} x`,
+			body:    map[string]interface{}{"parse_error": "unexpected data after json object"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := newJSONDecode(tt.options)
+			if err != nil {
+				t.Fatalf("newJSONDecode err = %v", err)
+			}
+			ev := &event.Event{Data: tt.data}
+			p.Process(ev)
+			if ev.Data != tt.message {
+				t.Errorf("message = %q, want %q", ev.Data, tt.message)
+			}
+			if !reflect.DeepEqual(ev.Body, tt.body) {
+				t.Errorf("body = %v, want %v", ev.Body, tt.body)
+			}
+		})
+	}
+}
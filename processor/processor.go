@@ -0,0 +1,194 @@
+package processor
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"test/conf"
+	"test/event"
+)
+
+//处理器在输入和kafka之间对日志做解析、过滤、补充字段等处理
+//每个[processor.xxx]小节配置一个处理器,收集项用processors=xxx,yyy按顺序引用
+//
+//自己写的处理器实现Processor接口,在init里用Register注册类型,再在main里用 import _ "xxx" 引入:
+//
+//	func init() {
+//		processor.Register("my_type", func(options map[string]string) (processor.Processor, error) {
+//			return &myProcessor{}, nil
+//		})
+//	}
+
+// Processor 处理一条日志,返回0条(丢掉)、1条或者多条日志
+// 所有处理器都在main的同一个goroutine里调用,不需要考虑并发;要改Fields时用SetField,不要直接改共用的map
+// Ack由Run统一处理,处理器不用管
+type Processor interface {
+	Process(ev *event.Event) []*event.Event
+}
+
+// Factory 用[processor.xxx]小节里除了type之外的配置项创建一个处理器
+// 每个引用它的收集项都会单独创建一个,处理器可以放自己的状态
+type Factory func(options map[string]string) (Processor, error)
+
+var (
+	factories = make(map[string]Factory)
+	chains    = make(map[string][]Processor) //key为event.Pipeline
+)
+
+// Register 注册一种处理器类型,重复注册会panic
+func Register(typ string, f Factory) {
+	if _, ok := factories[typ]; ok {
+		panic(fmt.Sprintf("processor type %q registered twice", typ))
+	}
+	factories[typ] = f
+}
+
+// Types 已经注册的处理器类型
+func Types() (types []string) {
+	for typ := range factories {
+		types = append(types, typ)
+	}
+	sort.Strings(types)
+	return
+}
+
+// Init 为每个配置了processors的输入创建处理链
+func Init(cfg *conf.AppConf) (err error) {
+	chains = make(map[string][]Processor)
+	for _, entry := range cfg.CollectEntries {
+		if err = build(cfg, "taillog."+entry.Name, entry.Processors); err != nil {
+			return
+		}
+	}
+	for _, entry := range cfg.ExecEntries {
+		if err = build(cfg, "exec."+entry.Name, entry.Processors); err != nil {
+			return
+		}
+	}
+	for _, entry := range cfg.ConsumeEntries {
+		if err = build(cfg, "consumer."+entry.Name, entry.Processors); err != nil {
+			return
+		}
+	}
+	if err = build(cfg, "syslog", cfg.SyslogConf.Processors); err != nil {
+		return
+	}
+	if err = build(cfg, "tcp", cfg.TCPConf.Processors); err != nil {
+		return
+	}
+	return build(cfg, "http", cfg.HTTPConf.Processors)
+}
+
+func build(cfg *conf.AppConf, pipeline string, names []string) error {
+	var chain []Processor
+	for _, name := range names {
+		if name == "" {
+			continue
+		}
+		pc, ok := cfg.Processors[name]
+		if !ok {
+			return fmt.Errorf("%s:processor %q not found", pipeline, name)
+		}
+		factory, ok := factories[pc.Type]
+		if !ok {
+			return fmt.Errorf("%s:processor %q has unknown type %q,registered types:%v", pipeline, name, pc.Type, Types())
+		}
+		p, err := factory(pc.Options)
+		if err != nil {
+			return fmt.Errorf("%s:create processor %q failed,err:%v", pipeline, name, err)
+		}
+		chain = append(chain, p)
+	}
+	if len(chain) > 0 {
+		chains[pipeline] = chain
+	}
+	return nil
+}
+
+// numberedOptions 按name、name2、name3...的顺序取出配置项,比如grok的pattern和备用的pattern2
+// name_xxx这样的是别的配置项,跳过
+func numberedOptions(options map[string]string, name string) (values []string, err error) {
+	order := make(map[string]int)
+	var keys []string
+	for key, v := range options {
+		suffix := strings.TrimPrefix(key, name)
+		if !strings.HasPrefix(key, name) || strings.HasPrefix(suffix, "_") || strings.TrimSpace(v) == "" {
+			continue
+		}
+		n := 1
+		if suffix != "" {
+			n, err = strconv.Atoi(suffix)
+			if err != nil || n < 2 {
+				return nil, fmt.Errorf("invalid option %q,use %s, %s2, %s3...", key, name, name, name)
+			}
+		}
+		order[key] = n
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no %s", name)
+	}
+	sort.Slice(keys, func(i, j int) bool { return order[keys[i]] < order[keys[j]] })
+	for _, key := range keys {
+		values = append(values, options[key])
+	}
+	return
+}
+
+// Run 让ev按顺序经过它所属的处理链
+// 被丢掉的日志直接确认成功;拆成多条的日志全部发送完才确认原来那条,有一条失败就算失败
+// 处理器会直接修改ev,ev.Ack也会被换掉,交给Run之后调用方不能再用ev,要重发时得重新构造
+func Run(ev *event.Event) []*event.Event {
+	chain := chains[ev.Pipeline]
+	if len(chain) == 0 {
+		return []*event.Event{ev}
+	}
+	ack := ev.Ack
+	ev.Ack = nil
+	events := []*event.Event{ev}
+	for _, p := range chain {
+		var next []*event.Event
+		for _, e := range events {
+			next = append(next, p.Process(e)...)
+		}
+		events = next
+		if len(events) == 0 {
+			break
+		}
+	}
+	if ack == nil {
+		return events
+	}
+	switch len(events) {
+	case 0:
+		ack(nil)
+	case 1:
+		events[0].Ack = ack
+	default:
+		joined := joinAck(ack, len(events))
+		for _, e := range events {
+			e.Ack = joined
+		}
+	}
+	return events
+}
+
+// joinAck n条日志都确认之后才调用ack,err是第一个失败的错误
+func joinAck(ack func(error), n int) func(error) {
+	var lock sync.Mutex
+	var firstErr error
+	return func(err error) {
+		lock.Lock()
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		n--
+		done := n == 0
+		lock.Unlock()
+		if done {
+			ack(firstErr)
+		}
+	}
+}
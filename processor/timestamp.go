@@ -0,0 +1,185 @@
+package processor
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"test/event"
+	"time"
+)
+
+//timestamp:从字段里解析出日志的时间,作为kafka消息的时间戳,json信封里是@timestamp(UTC)
+//  field:时间所在的字段,默认timestamp,比如grok提取出来的timestamp
+//  regex:可选,先用正则从字段里取出时间,取第一个括号里的内容,没有括号时取整个匹配
+//  layout、layout2、layout3...:按顺序尝试的格式,go的时间格式如2006-01-02 15:04:05,
+//      也可以写RFC3339、RFC1123Z、HTTPDATE、SYSLOG这些名字,unix和unix_ms是秒和毫秒的时间戳
+//  timezone:格式里没有时区时用哪个时区,默认Local,可以写UTC、Asia/Shanghai
+//SYSLOG这种没有年份的格式取不晚于现在一天以上的最近一年,推算出的年份没有2月29日时算解析失败
+//unix、unix_ms解析出来不在0~9999年之间时算不匹配,所以layout=unix、layout2=unix_ms可以同时支持秒和毫秒
+//解析失败时加上parse_error字段(已经有的不覆盖),日志照常发送
+
+func init() {
+	Register("timestamp", newTimestamp)
+}
+
+// namedLayouts 可以直接写名字的格式
+var namedLayouts = map[string]string{
+	"ANSIC":       time.ANSIC,
+	"UnixDate":    time.UnixDate,
+	"RFC822":      time.RFC822,
+	"RFC822Z":     time.RFC822Z,
+	"RFC850":      time.RFC850,
+	"RFC1123":     time.RFC1123,
+	"RFC1123Z":    time.RFC1123Z,
+	"RFC3339":     time.RFC3339,
+	"RFC3339Nano": time.RFC3339Nano,
+	"Stamp":       time.Stamp,
+	"StampMilli":  time.StampMilli,
+	"HTTPDATE":    "02/Jan/2006:15:04:05 -0700",
+	"SYSLOG":      time.Stamp,
+}
+
+// epochUnits 时间戳格式的单位
+var epochUnits = map[string]time.Duration{
+	"unix":    time.Second,
+	"unix_ms": time.Millisecond,
+}
+
+type timestamp struct {
+	field   string
+	re      *regexp.Regexp
+	layouts []string
+	loc     *time.Location
+	now     func() time.Time
+}
+
+func newTimestamp(options map[string]string) (Processor, error) {
+	p := &timestamp{field: "timestamp", loc: time.Local, now: time.Now}
+	if s, ok := options["field"]; ok {
+		p.field = strings.TrimSpace(s)
+	}
+	if p.field == "" {
+		return nil, fmt.Errorf("field is empty")
+	}
+	if s := options["regex"]; s != "" {
+		re, err := regexp.Compile(s)
+		if err != nil {
+			return nil, fmt.Errorf("compile regex %q failed,err:%v", s, err)
+		}
+		p.re = re
+	}
+	if s := strings.TrimSpace(options["timezone"]); s != "" {
+		loc, err := time.LoadLocation(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timezone %q,err:%v", s, err)
+		}
+		p.loc = loc
+	}
+	layouts, err := numberedOptions(options, "layout")
+	if err != nil {
+		return nil, err
+	}
+	for _, layout := range layouts {
+		if named, ok := namedLayouts[layout]; ok {
+			layout = named
+		}
+		p.layouts = append(p.layouts, layout)
+	}
+	return p, nil
+}
+
+func (p *timestamp) Process(ev *event.Event) []*event.Event {
+	value, ok := ev.Get(p.field)
+	if !ok {
+		p.fail(ev, fmt.Sprintf("field %q not found", p.field))
+		return []*event.Event{ev}
+	}
+	if p.re != nil {
+		m := p.re.FindStringSubmatch(value)
+		if m == nil {
+			p.fail(ev, fmt.Sprintf("timestamp regex does not match %q", value))
+			return []*event.Event{ev}
+		}
+		value = m[0]
+		if len(m) > 1 {
+			value = m[1]
+		}
+	}
+	value = strings.TrimSpace(value)
+	for _, layout := range p.layouts {
+		if t, err := p.parse(value, layout); err == nil {
+			ev.Time = t
+			return []*event.Event{ev}
+		}
+	}
+	p.fail(ev, fmt.Sprintf("no layout matched timestamp %q", value))
+	return []*event.Event{ev}
+}
+
+func (p *timestamp) parse(value, layout string) (t time.Time, err error) {
+	if unit, ok := epochUnits[layout]; ok {
+		return parseEpoch(value, unit)
+	}
+	t, err = time.ParseInLocation(layout, value, p.loc)
+	if err != nil || t.Year() != 0 {
+		return
+	}
+	//格式里没有年份,取不晚于现在一天以上的最近一年:12月31日的日志1月1日读到是去年的,快到新年时时钟快了几分钟的1月1日日志是明年的
+	now := p.now().In(t.Location())
+	year := now.Year() + 1
+	for withYear(t, year).After(now.Add(24 * time.Hour)) {
+		year--
+	}
+	parsed := t
+	t = withYear(parsed, year)
+	if t.Day() != parsed.Day() {
+		//2月29日,推算出来的年份不是闰年
+		return time.Time{}, fmt.Errorf("%q is not a valid date in %d", value, year)
+	}
+	return
+}
+
+func withYear(t time.Time, year int) time.Time {
+	return time.Date(year, t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+}
+
+// parseEpoch 解析秒或毫秒的时间戳,可以带小数,负数是1970年以前的时间
+func parseEpoch(value string, unit time.Duration) (t time.Time, err error) {
+	whole, frac := value, ""
+	if i := strings.IndexByte(value, '.'); i >= 0 {
+		whole, frac = value[:i], value[i+1:]
+	}
+	n, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil {
+		return
+	}
+	perSecond := int64(time.Second / unit)
+	t = time.Unix(n/perSecond, n%perSecond*int64(unit))
+	if frac != "" {
+		var f float64
+		f, err = strconv.ParseFloat("0."+frac, 64)
+		if err != nil {
+			return
+		}
+		//-1.5是-1再减0.5;-0.5的整数部分是0,要看符号
+		d := time.Duration(f * float64(unit))
+		if strings.HasPrefix(value, "-") {
+			d = -d
+		}
+		t = t.Add(d)
+	}
+	if y := t.Year(); y < 0 || y > 9999 {
+		//毫秒当成秒解析时会到几万年以后
+		return time.Time{}, fmt.Errorf("timestamp %q out of range", value)
+	}
+	return
+}
+
+// fail 不覆盖前面的处理器(比如grok)留下的parse_error
+func (p *timestamp) fail(ev *event.Event, reason string) {
+	if _, ok := ev.Body["parse_error"]; ok {
+		return
+	}
+	ev.Set("parse_error", reason)
+}
@@ -0,0 +1,129 @@
+package processor
+
+import (
+	"test/event"
+	"testing"
+	"time"
+)
+
+func TestParseEpoch(t *testing.T) {
+	tests := []struct {
+		value   string
+		unit    time.Duration
+		want    int64 //UnixNano
+		wantErr bool
+	}{
+		{value: "1700000000", unit: time.Second, want: 1700000000e9},
+		{value: "1.5", unit: time.Second, want: 1500000000},
+		{value: "-1", unit: time.Second, want: -1e9},
+		{value: "-1.5", unit: time.Second, want: -1500000000},
+		{value: "-0.5", unit: time.Second, want: -500000000},
+		{value: "1700000000123", unit: time.Millisecond, want: 1700000000123e6},
+		{value: "-1500.5", unit: time.Millisecond, want: -1500500000},
+		{value: "1700000000123", unit: time.Second, wantErr: true},
+		{value: "abc", unit: time.Second, wantErr: true},
+		{value: "1.x", unit: time.Second, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseEpoch(tt.value, tt.unit)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseEpoch(%q, %v) err = %v, wantErr %v", tt.value, tt.unit, err, tt.wantErr)
+			continue
+		}
+		if err == nil && got.UnixNano() != tt.want {
+			t.Errorf("parseEpoch(%q, %v) = %d, want %d", tt.value, tt.unit, got.UnixNano(), tt.want)
+		}
+	}
+}
+
+func TestParseWithoutYear(t *testing.T) {
+	tests := []struct {
+		name    string
+		now     time.Time
+		value   string
+		want    time.Time
+		wantErr bool
+	}{
+		{
+			name:  "this year",
+			now:   time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC),
+			value: "May 31 10:00:00",
+			want:  time.Date(2026, 5, 31, 10, 0, 0, 0, time.UTC),
+		},
+		{
+			name:  "less than a day ahead",
+			now:   time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC),
+			value: "Jun  1 23:00:00",
+			want:  time.Date(2026, 6, 1, 23, 0, 0, 0, time.UTC),
+		},
+		{
+			name:  "december read in january",
+			now:   time.Date(2027, 1, 1, 0, 30, 0, 0, time.UTC),
+			value: "Dec 31 23:59:59",
+			want:  time.Date(2026, 12, 31, 23, 59, 59, 0, time.UTC),
+		},
+		{
+			name:  "january read in december",
+			now:   time.Date(2026, 12, 31, 23, 50, 0, 0, time.UTC),
+			value: "Jan  1 00:10:00",
+			want:  time.Date(2027, 1, 1, 0, 10, 0, 0, time.UTC),
+		},
+		{
+			name:  "feb 29 in a leap year",
+			now:   time.Date(2028, 3, 1, 0, 0, 0, 0, time.UTC),
+			value: "Feb 29 10:00:00",
+			want:  time.Date(2028, 2, 29, 10, 0, 0, 0, time.UTC),
+		},
+		{
+			name:  "feb 29 just before it",
+			now:   time.Date(2028, 2, 28, 23, 0, 0, 0, time.UTC),
+			value: "Feb 29 10:00:00",
+			want:  time.Date(2028, 2, 29, 10, 0, 0, 0, time.UTC),
+		},
+		{
+			name:    "feb 29 in a non-leap year",
+			now:     time.Date(2027, 3, 1, 0, 0, 0, 0, time.UTC),
+			value:   "Feb 29 10:00:00",
+			wantErr: true,
+		},
+		{
+			name:  "feb 29 of last year",
+			now:   time.Date(2029, 1, 1, 0, 0, 0, 0, time.UTC),
+			value: "Feb 29 10:00:00",
+			want:  time.Date(2028, 2, 29, 10, 0, 0, 0, time.UTC),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := tt.now
+			p := &timestamp{loc: time.UTC, now: func() time.Time { return now }}
+			got, err := p.parse(tt.value, time.Stamp)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parse(%q) err = %v, wantErr %v", tt.value, err, tt.wantErr)
+			}
+			if err == nil && !got.Equal(tt.want) {
+				t.Errorf("parse(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTimestampSecondsOrMillis(t *testing.T) {
+	p, err := newTimestamp(map[string]string{"field": "ts", "layout": "unix", "layout2": "unix_ms"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for value, want := range map[string]int64{
+		"1700000000":    1700000000e9,
+		"1700000000123": 1700000000123e6,
+	} {
+		ev := &event.Event{Body: map[string]interface{}{"ts": value}}
+		p.Process(ev)
+		if ev.Time.UnixNano() != want {
+			t.Errorf("ts %s = %d, want %d", value, ev.Time.UnixNano(), want)
+		}
+		if _, ok := ev.Body["parse_error"]; ok {
+			t.Errorf("ts %s parse_error = %v", value, ev.Body["parse_error"])
+		}
+	}
+}
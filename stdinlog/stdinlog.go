@@ -0,0 +1,49 @@
+package stdinlog
+
+import (
+	"fmt"
+	"io"
+	"test/event"
+	"test/logio"
+)
+
+//从标准输入读日志,用于 some-command | logagent -stdin -topic debug 这种一次性的收集
+//读到EOF并且所有日志都被kafka确认后Done()可读
+
+var batch *logio.Batch
+
+// Init 开始读r,每行一条日志发到topic,超过maxBytes的行被截断
+func Init(r io.Reader, topic string, maxBytes int) {
+	batch = logio.NewBatch()
+	go read(r, topic, maxBytes)
+}
+
+// ReadChan 没有启动stdin输入时返回nil
+func ReadChan() <-chan *event.Event {
+	if batch == nil {
+		return nil
+	}
+	return batch.ReadChan()
+}
+
+// Done 没有启动stdin输入时返回nil
+func Done() <-chan struct{} {
+	if batch == nil {
+		return nil
+	}
+	return batch.Done()
+}
+
+// Stats 一共读了多少行,其中多少行发送失败
+func Stats() (total, fail int64) {
+	total, _, fail = batch.Stats()
+	return
+}
+
+func read(r io.Reader, topic string, maxBytes int) {
+	err := batch.ReadLines(r, topic, nil, maxBytes)
+	if err != nil {
+		fmt.Println("read stdin failed,err:", err)
+	}
+	batch.Close()
+}
@@ -0,0 +1,149 @@
+package syslog
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//解析RFC3164和RFC5424两种格式的syslog消息
+
+var facilityNames = []string{
+	"kern", "user", "mail", "daemon", "auth", "syslog", "lpr", "news",
+	"uucp", "cron", "authpriv", "ftp", "ntp", "security", "console", "solaris-cron",
+	"local0", "local1", "local2", "local3", "local4", "local5", "local6", "local7",
+}
+
+var severityNames = []string{
+	"emerg", "alert", "crit", "err", "warning", "notice", "info", "debug",
+}
+
+// parse 解析一条syslog消息,返回日志内容和facility、severity、hostname、app_name等元数据
+func parse(raw string) (msg string, fields map[string]string, err error) {
+	if !strings.HasPrefix(raw, "<") {
+		return raw, nil, errors.New("missing PRI")
+	}
+	end := strings.IndexByte(raw, '>')
+	if end < 2 || end > 4 {
+		return raw, nil, errors.New("invalid PRI")
+	}
+	//Atoi认-1、+1,所以先检查都是数字,否则负数会让下面取facility、severity越界
+	if !isDigits(raw[1:end]) {
+		return raw, nil, errors.New("invalid PRI")
+	}
+	pri, err := strconv.Atoi(raw[1:end])
+	if err != nil || pri > 191 {
+		return raw, nil, errors.New("invalid PRI")
+	}
+	fields = map[string]string{
+		"facility": facilityNames[pri/8],
+		"severity": severityNames[pri%8],
+	}
+	rest := raw[end+1:]
+	if len(rest) > 1 && rest[0] >= '1' && rest[0] <= '9' && rest[1] == ' ' {
+		msg, err = parse5424(rest[2:], fields)
+	} else {
+		msg = parse3164(rest, fields)
+	}
+	return
+}
+
+// parse5424 TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA MSG,-表示没有值
+func parse5424(s string, fields map[string]string) (msg string, err error) {
+	keys := []string{"timestamp", "hostname", "app_name", "procid", "msgid"}
+	for _, key := range keys {
+		i := strings.IndexByte(s, ' ')
+		if i < 0 {
+			return s, errors.New("truncated RFC5424 header")
+		}
+		if v := s[:i]; v != "-" {
+			fields[key] = v
+		}
+		s = s[i+1:]
+	}
+	sd, s, err := splitStructuredData(s)
+	if err != nil {
+		return s, err
+	}
+	if sd != "-" {
+		fields["structured_data"] = sd
+	}
+	s = strings.TrimPrefix(s, " ")
+	return strings.TrimPrefix(s, "\xef\xbb\xbf"), nil
+}
+
+// splitStructuredData 取出[id k="v"]...,值里的\]和\"是转义
+func splitStructuredData(s string) (sd, rest string, err error) {
+	if strings.HasPrefix(s, "-") {
+		return "-", s[1:], nil
+	}
+	i := 0
+	for i < len(s) && s[i] == '[' {
+		inQuote := false
+		for i++; i < len(s); i++ {
+			c := s[i]
+			if c == '\\' && inQuote {
+				i++
+				continue
+			}
+			if c == '"' {
+				inQuote = !inQuote
+			} else if c == ']' && !inQuote {
+				i++
+				break
+			}
+		}
+	}
+	if i == 0 {
+		return "", s, errors.New("invalid structured data")
+	}
+	return s[:i], s[i:], nil
+}
+
+// parse3164 Mmm dd hh:mm:ss HOSTNAME TAG[PID]: MSG
+// 很多设备发的格式不规范,解析不出来的部分直接留在日志内容里
+func parse3164(s string, fields map[string]string) string {
+	hasTimestamp := false
+	if len(s) >= len(time.Stamp) {
+		if _, err := time.Parse(time.Stamp, s[:len(time.Stamp)]); err == nil {
+			fields["timestamp"] = s[:len(time.Stamp)]
+			s = strings.TrimPrefix(s[len(time.Stamp):], " ")
+			hasTimestamp = true
+		}
+	}
+	//有的设备不发HOSTNAME,第一个字段就是TAG;没有时间戳时按RFC3164的规定整个都是日志内容
+	i := strings.IndexByte(s, ' ')
+	if hasTimestamp && i > 0 && !strings.HasSuffix(s[:i], ":") && !strings.Contains(s[:i], "[") {
+		fields["hostname"] = s[:i]
+		s = s[i+1:]
+	}
+	i = strings.IndexAny(s, "[: ")
+	if i <= 0 || i > 48 {
+		return s
+	}
+	tag := s[:i]
+	rest := s[i:]
+	if rest[0] == '[' {
+		j := strings.IndexByte(rest, ']')
+		if j < 0 {
+			return s
+		}
+		fields["procid"] = rest[1:j]
+		rest = rest[j+1:]
+	}
+	if !strings.HasPrefix(rest, ":") {
+		return s
+	}
+	fields["app_name"] = tag
+	return strings.TrimPrefix(rest[1:], " ")
+}
+
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
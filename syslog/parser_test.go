@@ -0,0 +1,110 @@
+package syslog
+
+import (
+	"bufio"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		msg     string
+		fields  map[string]string
+		wantErr bool
+	}{
+		{name: "missing PRI", raw: "hello", msg: "hello", wantErr: true},
+		{name: "negative PRI", raw: "<-1>hello", msg: "<-1>hello", wantErr: true},
+		{name: "signed PRI", raw: "<+1>hello", msg: "<+1>hello", wantErr: true},
+		{name: "PRI too large", raw: "<192>hello", msg: "<192>hello", wantErr: true},
+		{name: "PRI too long", raw: "<1234>hello", msg: "<1234>hello", wantErr: true},
+		{name: "empty PRI", raw: "<>hello", msg: "<>hello", wantErr: true},
+		{name: "unterminated PRI", raw: "<13 hello", msg: "<13 hello", wantErr: true},
+		{
+			name:   "rfc3164",
+			raw:    "<34>Oct 11 22:14:15 mymachine su[123]: 'su root' failed",
+			msg:    "'su root' failed",
+			fields: map[string]string{"facility": "auth", "severity": "crit", "timestamp": "Oct 11 22:14:15", "hostname": "mymachine", "app_name": "su", "procid": "123"},
+		},
+		{
+			name:   "rfc3164 without hostname",
+			raw:    "<13>Oct  1 02:03:04 sshd: accepted",
+			msg:    "accepted",
+			fields: map[string]string{"facility": "user", "severity": "notice", "timestamp": "Oct  1 02:03:04", "app_name": "sshd"},
+		},
+		{
+			name:   "rfc3164 without timestamp",
+			raw:    "<0>just a message",
+			msg:    "just a message",
+			fields: map[string]string{"facility": "kern", "severity": "emerg"},
+		},
+		{
+			name:   "rfc5424",
+			raw:    `<165>1 2003-10-11T22:14:15.003Z host app 42 ID47 [ex@32473 iut="3" x="a\]b"] An application event`,
+			msg:    "An application event",
+			fields: map[string]string{"facility": "local4", "severity": "notice", "timestamp": "2003-10-11T22:14:15.003Z", "hostname": "host", "app_name": "app", "procid": "42", "msgid": "ID47", "structured_data": `[ex@32473 iut="3" x="a\]b"]`},
+		},
+		{
+			name:   "rfc5424 nil values",
+			raw:    "<191>1 - - - - - - \xef\xbb\xbfbom message",
+			msg:    "bom message",
+			fields: map[string]string{"facility": "local7", "severity": "debug"},
+		},
+		{
+			name:    "rfc5424 truncated header",
+			raw:     "<14>1 2003-10-11T22:14:15Z host",
+			msg:     "host",
+			fields:  map[string]string{"facility": "user", "severity": "info", "timestamp": "2003-10-11T22:14:15Z"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, fields, err := parse(tt.raw)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parse(%q) err = %v, wantErr %v", tt.raw, err, tt.wantErr)
+			}
+			if msg != tt.msg {
+				t.Errorf("parse(%q) msg = %q, want %q", tt.raw, msg, tt.msg)
+			}
+			if tt.fields != nil && !reflect.DeepEqual(fields, tt.fields) {
+				t.Errorf("parse(%q) fields = %v, want %v", tt.raw, fields, tt.fields)
+			}
+		})
+	}
+}
+
+func TestReadFrame(t *testing.T) {
+	maxSize = 16
+	tests := []struct {
+		name      string
+		input     string
+		raw       string
+		truncated bool
+		wantErr   bool
+	}{
+		{name: "octet counting", input: "5 hello6 world!", raw: "hello"},
+		{name: "octet counting truncated", input: "20 aaaaaaaaaaaaaaaaaaaa", raw: "aaaaaaaaaaaaaaaa", truncated: true},
+		{name: "newline", input: "<13>hi\r\nnext", raw: "<13>hi"},
+		{name: "newline exactly max", input: "aaaaaaaaaaaaaaaa\n", raw: "aaaaaaaaaaaaaaaa"},
+		{name: "newline truncated", input: "aaaaaaaaaaaaaaaaaaaa\n", raw: "aaaaaaaaaaaaaaaa", truncated: true},
+		{name: "octet count too long", input: strings.Repeat("1", 64), wantErr: true},
+		{name: "octet count not a number", input: "12x hello", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw, truncated, err := readFrame(bufio.NewReader(strings.NewReader(tt.input)))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("readFrame(%q) err = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if raw != tt.raw || truncated != tt.truncated {
+				t.Errorf("readFrame(%q) = %q, %v, want %q, %v", tt.input, raw, truncated, tt.raw, tt.truncated)
+			}
+		})
+	}
+}
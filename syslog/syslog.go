@@ -0,0 +1,182 @@
+package syslog
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"test/conf"
+	"test/event"
+	"test/logio"
+)
+
+//接收网络设备等通过syslog发来的日志,支持udp和tcp
+//tcp支持RFC6587的两种分帧方式:"长度 消息"的octet-counting和按换行分隔
+
+var (
+	topic   string
+	maxSize int
+	logChan chan *event.Event
+)
+
+// Init 按配置监听udp和tcp地址,两个地址都为空时不启动
+func Init(cfg conf.SyslogConf) (err error) {
+	if cfg.UDPAddress == "" && cfg.TCPAddress == "" {
+		return
+	}
+	topic = cfg.Topic
+	maxSize = cfg.MaxMessageSize
+	logChan = make(chan *event.Event, 1000)
+	if cfg.UDPAddress != "" {
+		var pc net.PacketConn
+		pc, err = net.ListenPacket("udp", cfg.UDPAddress)
+		if err != nil {
+			return
+		}
+		go serveUDP(pc)
+	}
+	if cfg.TCPAddress != "" {
+		var l net.Listener
+		l, err = net.Listen("tcp", cfg.TCPAddress)
+		if err != nil {
+			return
+		}
+		go serveTCP(l)
+	}
+	return
+}
+
+// ReadChan 没有启动syslog时返回nil
+func ReadChan() <-chan *event.Event {
+	return logChan
+}
+
+func serveUDP(pc net.PacketConn) {
+	//多读一个字节,读满了说明数据报超过了max_message_size,超出的部分被丢掉了
+	buf := make([]byte, maxSize+1)
+	for {
+		n, addr, err := pc.ReadFrom(buf)
+		if err != nil {
+			fmt.Println("read syslog udp failed,err:", err)
+			continue
+		}
+		if n > maxSize {
+			handle(string(buf[:maxSize]), true, addr)
+			continue
+		}
+		handle(string(buf[:n]), false, addr)
+	}
+}
+
+func serveTCP(l net.Listener) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			fmt.Println("accept syslog tcp failed,err:", err)
+			continue
+		}
+		go serveConn(conn)
+	}
+}
+
+func serveConn(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReaderSize(conn, 64*1024)
+	for {
+		raw, truncated, err := readFrame(reader)
+		if err != nil {
+			if err != io.EOF {
+				fmt.Printf("read syslog from %s failed,err:%v\n", conn.RemoteAddr(), err)
+			}
+			return
+		}
+		handle(raw, truncated, conn.RemoteAddr())
+	}
+}
+
+// readFrame 以数字开头的是octet-counting,否则读到换行为止
+// 超过max_message_size的部分丢弃
+func readFrame(reader *bufio.Reader) (raw string, truncated bool, err error) {
+	b, err := reader.Peek(1)
+	if err != nil {
+		return
+	}
+	if b[0] >= '0' && b[0] <= '9' {
+		var n int
+		n, err = readOctetCount(reader)
+		if err != nil {
+			return
+		}
+		keep := n
+		if keep > maxSize {
+			keep = maxSize
+		}
+		buf := make([]byte, keep)
+		_, err = io.ReadFull(reader, buf)
+		if err != nil {
+			return
+		}
+		_, err = reader.Discard(n - keep)
+		return string(buf), n > keep, err
+	}
+
+	return logio.ReadLine(reader, maxSize)
+}
+
+// maxOctetDigits 长度前缀最多几位数字,免得对方一直发数字不发空格时无限占用内存
+const maxOctetDigits = 10
+
+// readOctetCount 读取"长度 "前缀
+func readOctetCount(reader *bufio.Reader) (n int, err error) {
+	var digits []byte
+	for {
+		var c byte
+		c, err = reader.ReadByte()
+		if err != nil {
+			return
+		}
+		if c == ' ' {
+			break
+		}
+		if c < '0' || c > '9' || len(digits) == maxOctetDigits {
+			return 0, fmt.Errorf("invalid octet count %q", append(digits, c))
+		}
+		digits = append(digits, c)
+	}
+	n, err = strconv.Atoi(string(digits))
+	if err != nil {
+		return 0, fmt.Errorf("invalid octet count %q", digits)
+	}
+	return
+}
+
+// handle truncated表示超过max_message_size被截断了
+func handle(raw string, truncated bool, addr net.Addr) {
+	raw = strings.TrimRight(raw, "\r\n\x00")
+	if raw == "" {
+		return
+	}
+	msg, fields, err := parse(raw)
+	if err != nil {
+		fmt.Printf("parse syslog %q from %s failed,err:%v\n", raw, addr, err)
+	}
+	if fields == nil {
+		fields = make(map[string]string)
+	}
+	if _, ok := fields["hostname"]; !ok {
+		if host, _, err := net.SplitHostPort(addr.String()); err == nil {
+			fields["hostname"] = host
+		}
+	}
+	if truncated {
+		fields["truncated"] = "true"
+	}
+	logChan <- &event.Event{
+		Topic:    topic,
+		Data:     msg,
+		Fields:   fields,
+		Pipeline: "syslog",
+	}
+}
@@ -15,7 +15,7 @@ func main() {
 		Follow:    true,                                 //是否跟随
 		Location:  &tail.SeekInfo{Offset: 0, Whence: 2}, //从文件的哪个地方开始读
 		MustExist: false,                                //文件不存在报错
-		Poll:      true,
+		Poll:      false,                                //用inotify监听文件变化,不轮询
 	}
 	tails, err := tail.TailFile(fileName, config) //打开文件
 	if err != nil {
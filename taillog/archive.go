@@ -0,0 +1,211 @@
+package taillog
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"test/logio"
+	"time"
+)
+
+//跟踪日志文件前先把切割出来的旧文件(app.log.2.gz、app.log.1.gz、app.log.1...)按从旧到新的顺序读一遍
+//读完的旧文件在registry里标记为done,以后不会再发送
+
+// archive 一个切割出来的旧文件,n是切割后缀的序号,越大越旧
+type archive struct {
+	path string
+	n    int
+}
+
+// findArchives 找出path切割出来的旧文件,按从旧到新排序
+func findArchives(path string) (archives []archive) {
+	pattern := regexp.MustCompile(`^` + regexp.QuoteMeta(filepath.Base(path)) + `\.(\d+)(\.gz|\.zst)?$`)
+	matches, _ := filepath.Glob(path + ".*")
+	for _, m := range matches {
+		sub := pattern.FindStringSubmatch(filepath.Base(m))
+		if sub == nil || !isRegular(m) {
+			continue
+		}
+		n, _ := strconv.Atoi(sub[1])
+		archives = append(archives, archive{path: m, n: n})
+	}
+	sort.Slice(archives, func(i, j int) bool {
+		return archives[i].n > archives[j].n
+	})
+	return
+}
+
+// archiveHoldInterval 多久重新找一次旧文件,在registry里占住还在的旧文件的记录
+const archiveHoldInterval = time.Minute
+
+// archiveSeen 见过的旧文件,文件没变时不用再解压算指纹
+type archiveSeen struct {
+	dev, ino uint64
+	size     int64
+	mtime    time.Time
+	key      string //在registry里的key
+}
+
+// backfill 依次读完所有旧文件,返回false表示已经被Stop
+func (f *follower) backfill() bool {
+	for _, a := range findArchives(f.path) {
+		ok, err := f.readArchive(a.path)
+		if err != nil {
+			fmt.Printf("backfill %s failed,err:%v\n", a.path, err)
+		}
+		if !ok {
+			return false
+		}
+	}
+	f.holdArchives()
+	return true
+}
+
+// archiveState 找出旧文件在registry里的记录,没有记录时返回一条新的
+// 没压缩的旧文件是改名出来的,inode和内容都没变,和跟踪它时是同一条记录
+// 压缩后inode和文件内容都变了,按解压后开头的指纹找跟踪它时的记录
+func (f *follower) archiveState(path string, file *os.File, info os.FileInfo) (state FileState, err error) {
+	state = FileState{Source: path}
+	if !logio.IsCompressed(path) {
+		var id identity
+		id, err = identify(file, info, f.entry, true)
+		if err != nil {
+			return
+		}
+		state.setIdentity(id)
+		if s := f.reg.get(state.Key()); s != nil {
+			state = *s
+		}
+		return
+	}
+	r, err := logio.Decompress(path, io.NewSectionReader(file, 0, info.Size()))
+	if err != nil {
+		return
+	}
+	state.Fingerprint, err = headFingerprint(r, f.fingerprintSize(), true)
+	r.Close()
+	if err != nil {
+		return
+	}
+	state.Dev, state.Ino = fileID(info)
+	switch f.entry.FileIdentity {
+	case "fingerprint":
+		state.ID = "fp-" + state.Fingerprint
+	case "fingerprint_inode":
+		state.ID = fmt.Sprintf("%d-%d-%s", state.Dev, state.Ino, state.Fingerprint)
+	}
+	if s := f.reg.get(state.Key()); s != nil {
+		state = *s
+	} else if s := f.reg.findFingerprint(state.Fingerprint); s != nil {
+		state = *s
+	}
+	return
+}
+
+// holdArchives 在registry里占住还在的旧文件的记录,旧文件被删除之前记录不会过期,重启后不会再发一遍
+func (f *follower) holdArchives() {
+	seen := make(map[string]archiveSeen)
+	for _, a := range findArchives(f.path) {
+		info, err := os.Stat(a.path)
+		if err != nil {
+			continue
+		}
+		dev, ino := fileID(info)
+		if c, ok := f.archives[a.path]; ok && c.dev == dev && c.ino == ino && c.size == info.Size() && c.mtime.Equal(info.ModTime()) {
+			seen[a.path] = c
+			continue
+		}
+		file, err := os.Open(a.path)
+		if err != nil {
+			continue
+		}
+		state, err := f.archiveState(a.path, file, info)
+		file.Close()
+		if err != nil {
+			continue
+		}
+		seen[a.path] = archiveSeen{dev: dev, ino: ino, size: info.Size(), mtime: info.ModTime(), key: state.Key()}
+	}
+	f.archives = seen
+	f.archivesAt = time.Now()
+	f.hold()
+}
+
+// readArchive 读一个旧文件,registry里的offset是解压后的偏移
+func (f *follower) readArchive(path string) (ok bool, err error) {
+	if !f.acquire() {
+		return false, nil
+	}
+	defer release()
+	file, err := os.Open(path)
+	if err != nil {
+		return true, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return true, err
+	}
+	state, err := f.archiveState(path, file, info)
+	if err != nil {
+		return true, err
+	}
+	if state.Done {
+		return true, nil
+	}
+	state.Source = path
+
+	r, err := logio.Decompress(path, file)
+	if err != nil {
+		return true, err
+	}
+	defer r.Close()
+	br := bufio.NewReader(r)
+	head, _ := br.Peek(2)
+	f.useCharset(f.charset.forBOM(head))
+	_, err = io.CopyN(ioutil.Discard, br, state.Offset)
+	if err != nil {
+		return true, err
+	}
+	fmt.Printf("backfill %s from offset %d\n", path, state.Offset)
+
+	//多读一行,这样才知道哪一行是最后一行,最后一行带上done标记
+	reader := newLineReader(br, f.delim, f.entry.MaxBytes)
+	var prev *line
+	for {
+		rec, err := reader.next()
+		partial := false
+		if err == io.EOF {
+			rec, partial = reader.pending(), true
+		}
+		if rec.size > 0 {
+			if prev != nil && !f.emitLine(prev) {
+				return false, nil
+			}
+			state.Offset += int64(rec.size)
+			prev = &line{text: f.dec.decode(rec.data), state: state, truncated: rec.truncated}
+			if partial {
+				prev.fields = map[string]string{"partial": "true"}
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return true, err
+		}
+	}
+	state.Done = true
+	if prev == nil {
+		f.reg.update(state)
+		return true, nil
+	}
+	prev.state = state
+	return f.emitLine(prev), nil
+}
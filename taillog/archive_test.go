@@ -0,0 +1,107 @@
+package taillog
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"test/conf"
+	"testing"
+	"time"
+)
+
+// follow 跟踪path,读到的每一行像TailTask.send一样更新registry
+func follow(t *testing.T, path string, reg *registry, entry *conf.CollectEntry, n int) (f *follower, texts []string) {
+	c, _ := newCharset("")
+	d, _ := newDelimiter("", c)
+	f = newFollower(path, reg, entry, c, d)
+	go f.run()
+	for len(texts) < n {
+		select {
+		case l := <-f.lines:
+			texts = append(texts, l.text)
+			reg.update(l.state)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("read %s timeout,got %q", path, texts)
+		}
+	}
+	return
+}
+
+func gzipFile(t *testing.T, src, dst string) {
+	data, err := ioutil.ReadFile(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := os.Create(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := gzip.NewWriter(out)
+	w.Write(data)
+	w.Close()
+	out.Close()
+	os.Remove(src)
+}
+
+// TestBackfillCompressedArchive 跟踪过的文件切割压缩后,重启时不会再发一遍
+func TestBackfillCompressedArchive(t *testing.T) {
+	var long []string
+	for i := 0; i < 200; i++ {
+		long = append(long, fmt.Sprintf("line %d", i))
+	}
+	tests := []struct {
+		name     string
+		identity string
+		lines    []string
+	}{
+		{name: "inode short file", identity: "inode", lines: []string{"a", "b"}},
+		{name: "inode", identity: "inode", lines: long},
+		{name: "fingerprint", identity: "fingerprint", lines: long},
+		{name: "fingerprint_inode", identity: "fingerprint_inode", lines: long},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "archive")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			path := filepath.Join(dir, "app.log")
+			ioutil.WriteFile(path, []byte(strings.Join(tt.lines, "\n")+"\n"), 0644)
+			reg, err := newRegistry(filepath.Join(dir, "registry.json"), time.Hour)
+			if err != nil {
+				t.Fatal(err)
+			}
+			entry := &conf.CollectEntry{
+				Path:             path,
+				StartPosition:    "beginning",
+				WatchMode:        "poll",
+				PollInterval:     10 * time.Millisecond,
+				BackfillArchives: true,
+				FileIdentity:     tt.identity,
+				FingerprintSize:  1024,
+			}
+			f, texts := follow(t, path, reg, entry, len(tt.lines))
+			f.Stop()
+			for range f.lines {
+			}
+			if len(texts) != len(tt.lines) {
+				t.Fatalf("got %d lines, want %d", len(texts), len(tt.lines))
+			}
+
+			//停机期间切割并压缩,旧文件删除前就建好新文件,免得新文件复用旧文件的inode
+			os.Rename(path, path+".1")
+			ioutil.WriteFile(path, []byte(strings.Repeat("new\n", 300)), 0644)
+			gzipFile(t, path+".1", path+".1.gz")
+
+			f, texts = follow(t, path, reg, entry, 1)
+			defer f.Stop()
+			if texts[0] != "new" {
+				t.Errorf("first line after restart = %q, want new", texts[0])
+			}
+		})
+	}
+}
@@ -0,0 +1,39 @@
+package taillog
+
+import (
+	"bytes"
+	"io"
+	"os"
+)
+
+//开头看起来不是文本的文件(压缩包、可执行文件、数据库文件等)不收集,免得往kafka里灌乱码
+//通配符把app.log.1.gz这种切割出来的压缩文件也匹配进来时最常见
+
+// binarySniffSize 看文件开头多少字节
+const binarySniffSize = 1024
+
+// isBinary 文件开头有NUL或者超过一成是控制字符就认为不是文本
+// utf-16的文本本来就有很多NUL,不检查;分隔符里有NUL时NUL不算
+func isBinary(file *os.File, d *delimiter) bool {
+	if d.unit != 1 {
+		return false
+	}
+	buf := make([]byte, binarySniffSize)
+	n, err := file.ReadAt(buf, 0)
+	if err != nil && err != io.EOF {
+		return false
+	}
+	buf = buf[:n]
+	allowNUL := d.re != nil || bytes.IndexByte(d.literal, 0) >= 0
+	control := 0
+	for _, b := range buf {
+		switch {
+		case b == 0 && !allowNUL:
+			return true
+		case b == 0, b == '\t', b == '\n', b == '\r', b == '\f', b == '\v', b == '\b', b == 0x1b:
+		case b < 0x20 || b == 0x7f:
+			control++
+		}
+	}
+	return control*10 > len(buf)
+}
@@ -0,0 +1,88 @@
+package taillog
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+//解析容器日志的格式,取出真正的日志内容,stream和time放到fields里
+//  docker:json-file驱动,每行是{"log":"...\n","stream":"stderr","time":"..."}
+//         超过16K的日志会被拆成多行,只有最后一行的log以\n结尾
+//  cri:kubernetes的/var/log/pods,每行是"time stream P|F 日志",P表示被拆开的前半部分
+
+type containerParser struct {
+	format  string
+	partial map[string]*line //还没拼完整的日志,key为stream
+}
+
+// newContainerParser format为空或plain时返回nil
+func newContainerParser(format string) (p *containerParser, err error) {
+	switch format {
+	case "", "plain":
+		return
+	case "docker", "cri":
+	default:
+		return nil, fmt.Errorf("invalid format %q,must be plain, docker or cri", format)
+	}
+	p = &containerParser{
+		format:  format,
+		partial: make(map[string]*line),
+	}
+	return
+}
+
+type dockerLine struct {
+	Log    string `json:"log"`
+	Stream string `json:"stream"`
+	Time   string `json:"time"`
+}
+
+// parse 解析一行,被拆开的日志还没拼完整时返回nil
+func (p *containerParser) parse(l *line) *line {
+	var msg, stream, ts string
+	var partial bool
+	if p.format == "docker" {
+		var dl dockerLine
+		err := json.Unmarshal([]byte(l.text), &dl)
+		if err != nil {
+			fmt.Printf("parse docker log %q failed,err:%v\n", l.text, err)
+			return l
+		}
+		msg, stream, ts = dl.Log, dl.Stream, dl.Time
+		partial = !strings.HasSuffix(msg, "\n")
+		msg = strings.TrimSuffix(msg, "\n")
+	} else {
+		parts := strings.SplitN(l.text, " ", 4)
+		if len(parts) < 3 {
+			fmt.Printf("parse cri log %q failed\n", l.text)
+			return l
+		}
+		ts, stream = parts[0], parts[1]
+		partial = parts[2] == "P"
+		if len(parts) == 4 {
+			msg = parts[3]
+		}
+	}
+
+	truncated := l.truncated
+	if prev, ok := p.partial[stream]; ok {
+		prev.text += msg
+		prev.state = l.state
+		truncated = truncated || prev.truncated
+		msg = prev.text
+		ts = prev.fields["time"] //拼起来的日志用第一部分的时间
+	}
+	out := &line{
+		text:      msg,
+		state:     l.state,
+		fields:    map[string]string{"stream": stream, "time": ts},
+		truncated: truncated,
+	}
+	if partial {
+		p.partial[stream] = out
+		return nil
+	}
+	delete(p.partial, stream)
+	return out
+}
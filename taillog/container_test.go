@@ -0,0 +1,128 @@
+package taillog
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestContainerParser(t *testing.T) {
+	fields := func(stream, ts string) map[string]string {
+		return map[string]string{"stream": stream, "time": ts}
+	}
+	tests := []struct {
+		name   string
+		format string
+		lines  []string
+		cut    map[int]bool //第几行(从0开始)超过max_bytes被截断了
+		want   []*line      //每一行解析的结果,还没拼完整时为nil
+	}{
+		{
+			name:   "docker",
+			format: "docker",
+			lines:  []string{`{"log":"hello\n","stream":"stdout","time":"t1"}`},
+			want:   []*line{{text: "hello", state: FileState{Offset: 1}, fields: fields("stdout", "t1")}},
+		},
+		{
+			name:   "docker partial",
+			format: "docker",
+			lines: []string{
+				`{"log":"ab","stream":"stdout","time":"t1"}`,
+				`{"log":"cd","stream":"stdout","time":"t2"}`,
+				`{"log":"ef\n","stream":"stdout","time":"t3"}`,
+			},
+			want: []*line{nil, nil, {text: "abcdef", state: FileState{Offset: 3}, fields: fields("stdout", "t1")}},
+		},
+		{
+			name:   "docker partial per stream",
+			format: "docker",
+			lines: []string{
+				`{"log":"ab","stream":"stdout","time":"t1"}`,
+				`{"log":"oops\n","stream":"stderr","time":"t2"}`,
+				`{"log":"cd\n","stream":"stdout","time":"t3"}`,
+			},
+			want: []*line{
+				nil,
+				{text: "oops", state: FileState{Offset: 2}, fields: fields("stderr", "t2")},
+				{text: "abcd", state: FileState{Offset: 3}, fields: fields("stdout", "t1")},
+			},
+		},
+		{
+			name:   "docker truncated part",
+			format: "docker",
+			lines: []string{
+				`{"log":"ab","stream":"stdout","time":"t1"}`,
+				`{"log":"cd\n","stream":"stdout","time":"t2"}`,
+			},
+			cut:  map[int]bool{0: true},
+			want: []*line{nil, {text: "abcd", state: FileState{Offset: 2}, fields: fields("stdout", "t1"), truncated: true}},
+		},
+		{
+			name:   "docker invalid json",
+			format: "docker",
+			lines:  []string{`not json`},
+			want:   []*line{{text: "not json", state: FileState{Offset: 1}}},
+		},
+		{
+			name:   "cri",
+			format: "cri",
+			lines:  []string{"2024-01-02T03:04:05.000Z stdout F hello world"},
+			want:   []*line{{text: "hello world", state: FileState{Offset: 1}, fields: fields("stdout", "2024-01-02T03:04:05.000Z")}},
+		},
+		{
+			name:   "cri partial per stream",
+			format: "cri",
+			lines: []string{
+				"t1 stdout P ab",
+				"t2 stderr P x",
+				"t3 stdout P cd",
+				"t4 stderr F y",
+				"t5 stdout F ef",
+			},
+			want: []*line{
+				nil,
+				nil,
+				nil,
+				{text: "xy", state: FileState{Offset: 4}, fields: fields("stderr", "t2")},
+				{text: "abcdef", state: FileState{Offset: 5}, fields: fields("stdout", "t1")},
+			},
+		},
+		{
+			name:   "cri empty message",
+			format: "cri",
+			lines:  []string{"t1 stdout F"},
+			want:   []*line{{text: "", state: FileState{Offset: 1}, fields: fields("stdout", "t1")}},
+		},
+		{
+			name:   "cri malformed",
+			format: "cri",
+			lines:  []string{"garbage"},
+			want:   []*line{{text: "garbage", state: FileState{Offset: 1}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := newContainerParser(tt.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, text := range tt.lines {
+				got := p.parse(&line{text: text, state: FileState{Offset: int64(i + 1)}, truncated: tt.cut[i]})
+				if !reflect.DeepEqual(got, tt.want[i]) {
+					t.Errorf("parse(%q) = %+v, want %+v", text, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestNewContainerParser(t *testing.T) {
+	for format, wantNil := range map[string]bool{"": true, "plain": true, "docker": false, "cri": false} {
+		p, err := newContainerParser(format)
+		if err != nil || (p == nil) != wantNil {
+			t.Errorf("newContainerParser(%q) = %v, %v", format, p, err)
+		}
+	}
+	if _, err := newContainerParser("json"); err == nil {
+		t.Errorf("newContainerParser(json) err = nil")
+	}
+}
@@ -0,0 +1,121 @@
+package taillog
+
+import (
+	"bytes"
+	"fmt"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/unicode"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+//把GBK、GB18030、UTF-16等编码的日志转成UTF-8
+//非法的字节序列替换成U+FFFD并计数,不会丢掉整行
+
+// charset 一种日志编码:怎么切行、怎么解码
+type charset struct {
+	name  string
+	delim []byte //换行符在这种编码下的字节
+	unit  int
+	enc   encoding.Encoding //为nil时是utf-8,只检查非法字节
+	be    *charset          //utf-16没写字节序时,文件开头是大端的BOM就换成它
+}
+
+func newCharset(name string) (c *charset, err error) {
+	if name == "" {
+		name = "utf-8"
+	}
+	c = &charset{name: name, delim: []byte{'\n'}, unit: 1}
+	switch strings.ToLower(name) {
+	case "utf-8", "utf8":
+	case "gbk", "gb2312":
+		c.enc = simplifiedchinese.GBK
+	case "gb18030":
+		c.enc = simplifiedchinese.GB18030
+	case "utf-16":
+		//windows下的utf-16一般是小端的,打开文件时看开头的BOM,是大端的再换成utf-16be
+		c.enc = unicode.UTF16(unicode.LittleEndian, unicode.UseBOM)
+		c.delim, c.unit = []byte{'\n', 0}, 2
+		c.be, _ = newCharset("utf-16be")
+	case "utf-16le":
+		c.enc = unicode.UTF16(unicode.LittleEndian, unicode.UseBOM)
+		c.delim, c.unit = []byte{'\n', 0}, 2
+	case "utf-16be":
+		c.enc = unicode.UTF16(unicode.BigEndian, unicode.UseBOM)
+		c.delim, c.unit = []byte{0, '\n'}, 2
+	default:
+		return nil, fmt.Errorf("unsupported encoding %q", name)
+	}
+	return
+}
+
+// forBOM head是文件开头的几个字节,按BOM选用哪种字节序
+func (c *charset) forBOM(head []byte) *charset {
+	if c.be != nil && bytes.HasPrefix(head, []byte{0xfe, 0xff}) {
+		return c.be
+	}
+	return c
+}
+
+// decoder 每个follower一个,encoding.Decoder不能并发使用
+type decoder struct {
+	path    string
+	charset *charset
+	dec     *encoding.Decoder
+	invalid int64 //一共替换了多少个非法字节序列
+	logged  time.Time
+}
+
+func newDecoder(path string, c *charset) *decoder {
+	d := &decoder{path: path, charset: c}
+	if c.enc != nil {
+		d.dec = c.enc.NewDecoder()
+	}
+	return d
+}
+
+// decode 转成UTF-8
+func (d *decoder) decode(data []byte) string {
+	if d.dec == nil {
+		if utf8.Valid(data) {
+			return string(data)
+		}
+		return d.replaceInvalid(data)
+	}
+	out, err := d.dec.Bytes(data)
+	if err != nil {
+		fmt.Printf("decode %s with %s failed,err:%v\n", d.path, d.charset.name, err)
+	}
+	if n := bytes.Count(out, []byte(string(utf8.RuneError))); n > 0 {
+		d.count(n)
+	}
+	return string(out)
+}
+
+// replaceInvalid 把不是合法utf-8的字节换成U+FFFD
+func (d *decoder) replaceInvalid(data []byte) string {
+	var sb strings.Builder
+	n := 0
+	for len(data) > 0 {
+		r, size := utf8.DecodeRune(data)
+		if r == utf8.RuneError && size == 1 {
+			n++
+		}
+		sb.WriteRune(r)
+		data = data[size:]
+	}
+	d.count(n)
+	return sb.String()
+}
+
+// count 累计非法字节序列的个数,最多一分钟打一次日志
+func (d *decoder) count(n int) {
+	d.invalid += int64(n)
+	if time.Since(d.logged) < time.Minute {
+		return
+	}
+	d.logged = time.Now()
+	fmt.Printf("%s has %d invalid %s byte sequences replaced so far\n", d.path, d.invalid, d.charset.name)
+}
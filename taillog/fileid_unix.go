@@ -0,0 +1,17 @@
+//go:build !windows
+// +build !windows
+
+package taillog
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileID 取文件所在设备号和inode号
+func fileID(info os.FileInfo) (dev, ino uint64) {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return uint64(st.Dev), uint64(st.Ino)
+	}
+	return
+}
@@ -0,0 +1,13 @@
+//go:build windows
+// +build windows
+
+package taillog
+
+import (
+	"os"
+)
+
+// fileID windows下没有inode,返回0,只能靠路径识别文件
+func fileID(info os.FileInfo) (dev, ino uint64) {
+	return
+}
@@ -0,0 +1,81 @@
+package taillog
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"test/conf"
+)
+
+//按file_identity识别文件,registry里的key就是识别出来的id
+//  inode:设备号+inode,容器主机上inode很快被复用,新文件可能被当成旧文件从旧的偏移开始读
+//  fingerprint:文件开头fingerprint_size字节的hash,改名后还能认出来,inode被复用也不会认错
+//  fingerprint_inode:hash和inode都对上才算同一个文件,适合很多文件开头内容一样的情况
+
+// errTooSmall 按指纹识别时文件还不够fingerprint_size字节,等写够了再读
+var errTooSmall = errors.New("file is smaller than fingerprint_size")
+
+// identity 识别出来的文件
+type identity struct {
+	dev, ino    uint64
+	fingerprint string
+	id          string //registry里的key,为空时按设备号和inode
+}
+
+func checkFileIdentity(entry *conf.CollectEntry) error {
+	switch entry.FileIdentity {
+	case "inode", "":
+		return nil
+	case "fingerprint", "fingerprint_inode":
+		if entry.FingerprintSize <= 0 {
+			return fmt.Errorf("fingerprint_size must be positive,got %d", entry.FingerprintSize)
+		}
+		return nil
+	}
+	return fmt.Errorf("invalid file_identity %q,must be inode, fingerprint or fingerprint_inode", entry.FileIdentity)
+}
+
+// identify final表示文件不会再变(切割出来的旧文件),不够fingerprint_size字节时用整个文件算
+func identify(file *os.File, info os.FileInfo, entry *conf.CollectEntry, final bool) (id identity, err error) {
+	id.dev, id.ino = fileID(info)
+	if entry.FileIdentity == "inode" || entry.FileIdentity == "" {
+		return
+	}
+	id.fingerprint, err = headFingerprint(io.NewSectionReader(file, 0, info.Size()), entry.FingerprintSize, final)
+	if err != nil {
+		return
+	}
+	if entry.FileIdentity == "fingerprint" {
+		id.id = "fp-" + id.fingerprint
+	} else {
+		id.id = fmt.Sprintf("%d-%d-%s", id.dev, id.ino, id.fingerprint)
+	}
+	return
+}
+
+// headFingerprint 开头size字节的sha256,final表示内容不会再变,不够size字节时用全部内容算
+func headFingerprint(r io.Reader, size int, final bool) (fingerprint string, err error) {
+	buf := make([]byte, size)
+	n, err := io.ReadFull(r, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return
+	}
+	err = nil
+	if n < len(buf) && (!final || n == 0) {
+		return "", errTooSmall
+	}
+	sum := sha256.Sum256(buf[:n])
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// is 是不是同一个文件,按inode识别时记录里的指纹只是用来认出压缩后的旧文件,不参与比较
+func (s *FileState) is(id identity) bool {
+	return s.Dev == id.dev && s.Ino == id.ino && (id.id == "" || s.Fingerprint == id.fingerprint)
+}
+
+func (s *FileState) setIdentity(id identity) {
+	s.Dev, s.Ino, s.Fingerprint, s.ID = id.dev, id.ino, id.fingerprint, id.id
+}
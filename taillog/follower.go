@@ -0,0 +1,442 @@
+package taillog
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"test/conf"
+	"time"
+)
+
+//按设备号和inode跟踪一个日志文件,处理日志切割
+//  rename切割:旧文件被改名后先把旧文件剩下的内容读完,再切到同名的新文件
+//  copytruncate切割:文件变得比已经读到的偏移还小,说明被清空了,从头开始读
+//  先改名过一会才创建新文件:新文件出现前一直读旧文件
+
+// inotify模式下最多等这么久也要检查一次文件,防止漏掉事件
+const inotifyFallbackInterval = 10 * time.Second
+
+// errBinary 文件开头看起来不是文本,按skip_binary跳过
+var errBinary = errors.New("binary file")
+
+// line 读到的一行,state是读完这一行之后的收集进度
+type line struct {
+	text      string
+	state     FileState
+	fields    map[string]string //容器日志的stream、time等元数据
+	truncated bool              //超过max_bytes被截断了
+}
+
+type follower struct {
+	path  string
+	reg   *registry
+	entry *conf.CollectEntry
+
+	charset   *charset
+	delim     *delimiter
+	dec       *decoder
+	file      *os.File
+	reader    *lineReader
+	state     FileState
+	opened    bool          //是否打开过文件,只有第一次打开时才从registry恢复偏移
+	fromStart bool          //启动后才出现的文件,registry里没有记录时从头读
+	missing   bool          //文件不存在,已经打印过提示
+	seenSize  int64         //第一次看到文件时的大小,start_position=end时从这里开始读,-1表示还没看到过
+	draining  bool          //发现文件被改名,读完旧文件剩下的内容后再切到新文件
+	notify    chan struct{} //inotify通知,为nil时轮询
+	lastRead  time.Time     //最后一次读到数据的时间
+	inactive  bool          //因为太久没有新数据关闭了文件
+
+	partialSize int       //上次检查时没有分隔符的半行有多长
+	partialAt   time.Time //半行最后一次变长的时间,超过partial_line_timeout没变就发出去
+
+	archives   map[string]archiveSeen //还在的旧文件,key为路径
+	archivesAt time.Time              //上次找旧文件的时间
+
+	lines chan *line
+	done  chan struct{}
+	gone  chan struct{} //文件不再匹配通配符,读完已经打开的文件就退出
+}
+
+func newFollower(path string, reg *registry, entry *conf.CollectEntry, c *charset, d *delimiter) *follower {
+	return &follower{
+		path:     path,
+		reg:      reg,
+		entry:    entry,
+		charset:  c,
+		delim:    d,
+		dec:      newDecoder(path, c),
+		state:    FileState{Source: path},
+		seenSize: -1,
+		lines:    make(chan *line),
+		done:     make(chan struct{}),
+		gone:     make(chan struct{}),
+	}
+}
+
+func (f *follower) run() {
+	defer close(f.lines)
+	defer f.reg.hold(f, nil)
+	defer f.closeFile()
+	f.startWatch()
+	defer f.stopWatch()
+	if f.entry.BackfillArchives && !f.backfill() {
+		return
+	}
+	for {
+		if f.file == nil {
+			if f.isGone() {
+				return
+			}
+			if f.inactive && !f.changed() {
+				if !f.wait() {
+					return
+				}
+				continue
+			}
+			if !f.acquire() {
+				return
+			}
+			err := f.open()
+			if err != nil {
+				release()
+				if os.IsNotExist(err) && !f.opened {
+					//启动时还不存在的文件,出现后从头读
+					f.fromStart = true
+				}
+				if os.IsNotExist(err) && !f.missing {
+					fmt.Printf("%s does not exist,wait for it to be created\n", f.path)
+				}
+				f.missing = os.IsNotExist(err)
+				if err != errBinary && err != errTooSmall && !os.IsNotExist(err) {
+					fmt.Printf("open %s failed,err:%v\n", f.path, err)
+				}
+				if !f.wait() {
+					return
+				}
+				continue
+			}
+		}
+		rec, err := f.reader.next()
+		if err == nil {
+			if !f.emit(rec, false) {
+				return
+			}
+			continue
+		}
+		if err != io.EOF {
+			fmt.Printf("read %s failed,err:%v\n", f.path, err)
+			f.closeFile()
+		} else if f.isGone() {
+			//和切割时一样多等一个轮询周期,让还在往文件写的内容写完
+			if f.draining {
+				if partial := f.reader.pending(); partial.size > 0 {
+					f.emit(partial, true)
+				}
+				return
+			}
+			f.draining = true
+		} else if f.checkRotate() || f.flushPartial() {
+			continue
+		} else {
+			f.closeIfInactive()
+		}
+		if f.entry.BackfillArchives && time.Since(f.archivesAt) > archiveHoldInterval {
+			f.holdArchives()
+		}
+		if !f.wait() {
+			return
+		}
+	}
+}
+
+// open 打开文件并决定从哪里开始读
+func (f *follower) open() (err error) {
+	file, err := os.Open(f.path)
+	if err != nil {
+		return
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return
+	}
+	if f.seenSize < 0 {
+		f.seenSize = info.Size()
+	}
+	dev, ino := fileID(info)
+	if f.entry.SkipBinary && isBinary(file, f.delim) {
+		file.Close()
+		//和不活跃的文件一样,文件有变化时再检查一次,同一个文件只警告一次
+		if !f.inactive || dev != f.state.Dev || ino != f.state.Ino {
+			fmt.Printf("%s looks like a binary file,skip it\n", f.path)
+		}
+		f.state.Dev, f.state.Ino, f.state.Offset = dev, ino, info.Size()
+		f.inactive = true
+		return errBinary
+	}
+	id, err := identify(file, info, f.entry, false)
+	if err != nil {
+		file.Close()
+		return
+	}
+	switch {
+	case !f.opened:
+		//registry里有这个文件的记录就从记录的偏移继续读,否则按start_position从头或从尾开始
+		f.state.setIdentity(id)
+		f.state.Offset = 0
+		s := f.reg.get(f.state.Key())
+		if s != nil && s.Offset <= info.Size() {
+			f.state.Offset = s.Offset
+			if f.state.ID == "" {
+				//按inode识别时指纹不参与识别,用记录里的,免得从偏移继续读时指纹丢了
+				f.state.Fingerprint = s.Fingerprint
+			}
+			fmt.Printf("resume %s from offset %d\n", f.path, s.Offset)
+		} else if s != nil {
+			//停机期间文件被copytruncate清空过,从头读,不能按start_position跳到末尾
+			fmt.Printf("%s truncated,size %d < offset %d,read from beginning\n", f.path, info.Size(), s.Offset)
+		} else if f.entry.StartPosition == "end" && !f.fromStart && f.seenSize <= info.Size() {
+			//按指纹识别时文件可能等了一会才写够,从第一次看到它时的末尾开始读
+			f.state.Offset = f.seenSize
+		}
+	case f.state.is(id) && f.state.Offset <= info.Size():
+		//读出错或者不活跃关闭后重新打开的还是同一个文件,从原来的偏移继续读
+	default:
+		f.state.setIdentity(id)
+		f.state.Offset = 0
+	}
+	_, err = file.Seek(f.state.Offset, io.SeekStart)
+	if err != nil {
+		file.Close()
+		return
+	}
+	head := make([]byte, 2)
+	n, _ := file.ReadAt(head, 0)
+	f.useCharset(f.charset.forBOM(head[:n]))
+	f.hold()
+	f.file = file
+	f.reader = newLineReader(file, f.delim, f.entry.MaxBytes)
+	f.opened = true
+	f.inactive = false
+	f.lastRead = time.Now()
+	return
+}
+
+// hold 在registry里占住正在跟踪的文件和还在的旧文件的记录,这期间不会过期
+func (f *follower) hold() {
+	keys := []string{f.state.Key()}
+	for _, a := range f.archives {
+		keys = append(keys, a.key)
+	}
+	f.reg.hold(f, keys)
+}
+
+func checkStartPosition(entry *conf.CollectEntry) error {
+	switch entry.StartPosition {
+	case "beginning", "end":
+		return nil
+	}
+	return fmt.Errorf("invalid start_position %q,must be beginning or end", entry.StartPosition)
+}
+
+// useCharset 按文件开头的BOM换了字节序时,分隔符和解码器也跟着换
+func (f *follower) useCharset(c *charset) {
+	if f.dec.charset == c {
+		return
+	}
+	//配置的分隔符启动时已经检查过,换个字节序不会出错
+	f.delim, _ = newDelimiter(f.entry.Delimiter, c)
+	f.dec = newDecoder(f.path, c)
+}
+
+// fingerprintSize 按inode识别文件时也要记下开头的指纹,用来认出压缩后的旧文件
+func (f *follower) fingerprintSize() int {
+	if f.entry.FingerprintSize > 0 {
+		return f.entry.FingerprintSize
+	}
+	return 1024
+}
+
+func (f *follower) closeFile() {
+	if f.file != nil {
+		f.file.Close()
+		f.file = nil
+		release()
+	}
+}
+
+// checkRotate 读到文件末尾时检查文件有没有被切割,返回true表示要马上接着读
+func (f *follower) checkRotate() bool {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		//文件被删除或改名后还没创建新文件,继续等旧文件
+		return false
+	}
+	dev, ino := fileID(info)
+	if dev != f.state.Dev || ino != f.state.Ino {
+		if !f.draining {
+			//等一个轮询周期,让还在往旧文件写的内容写完
+			f.draining = true
+			return false
+		}
+		partial := f.reader.pending()
+		fmt.Printf("%s rotated,inode %d -> %d,old file read to offset %d\n", f.path, f.state.Ino, ino, f.state.Offset+int64(partial.size))
+		if partial.size > 0 {
+			//旧文件最后没有分隔符的半行也发出去
+			f.emit(partial, true)
+		}
+		f.draining = false
+		f.closeFile()
+		return true
+	}
+	f.draining = false
+
+	info, err = f.file.Stat()
+	if err != nil {
+		return false
+	}
+	if info.Size() < f.state.Offset+int64(f.reader.pending().size) {
+		fmt.Printf("%s truncated,size %d < offset %d,read from beginning\n", f.path, info.Size(), f.state.Offset)
+		_, err = f.file.Seek(0, io.SeekStart)
+		if err != nil {
+			fmt.Printf("seek %s failed,err:%v\n", f.path, err)
+			f.closeFile()
+			return false
+		}
+		f.reader.reset(f.file)
+		f.state.Offset = 0
+		return true
+	}
+	return false
+}
+
+// flushPartial 文件末尾没有分隔符的半行超过partial_line_timeout没有变长,就当作一行发出去
+func (f *follower) flushPartial() bool {
+	timeout := f.entry.PartialLineTimeout
+	size := f.reader.pending().size
+	if timeout <= 0 || size == 0 {
+		f.partialSize = 0
+		return false
+	}
+	if size != f.partialSize {
+		f.partialSize = size
+		f.partialAt = time.Now()
+		return false
+	}
+	if time.Since(f.partialAt) < timeout {
+		return false
+	}
+	f.partialSize = 0
+	f.emit(f.reader.flush(), true)
+	return true
+}
+
+// emit 把当前文件的一行解码后交给TailTask,返回false表示已经被Stop
+// partial表示这一行没有分隔符
+func (f *follower) emit(rec record, partial bool) bool {
+	prev := f.state.Offset
+	f.state.Offset += int64(rec.size)
+	if size := int64(f.fingerprintSize()); f.state.ID == "" && prev < size && f.state.Offset > 0 {
+		//按inode识别时也记下开头的指纹,文件被切割压缩后靠它找到这条记录
+		//还没读够fingerprint_size字节时按已经读到的全部内容算,和压缩后的小文件算出来的一样
+		n := f.state.Offset
+		if n > size {
+			n = size
+		}
+		if fp, err := headFingerprint(io.NewSectionReader(f.file, 0, n), int(n), true); err == nil {
+			f.state.Fingerprint = fp
+		}
+	}
+	f.lastRead = time.Now()
+	l := &line{text: f.dec.decode(rec.data), state: f.state, truncated: rec.truncated}
+	if partial {
+		l.fields = map[string]string{"partial": "true"}
+	}
+	return f.emitLine(l)
+}
+
+func (f *follower) emitLine(l *line) bool {
+	select {
+	case f.lines <- l:
+		return true
+	case <-f.done:
+		return false
+	}
+}
+
+// startWatch 按watch_mode决定用inotify还是轮询
+//
+//	inotify:用inotify,监听失败时退回轮询
+//	poll:每隔poll_interval检查一次文件
+//	auto:nfs、cifs、fuse、overlay等inotify不可靠的文件系统上轮询,其他用inotify
+func (f *follower) startWatch() {
+	mode := f.entry.WatchMode
+	if mode == "poll" {
+		return
+	}
+	if mode == "auto" && inotifyUnreliable(filepath.Dir(f.path)) {
+		fmt.Printf("%s is on a filesystem without reliable inotify,use polling\n", f.path)
+		return
+	}
+	ch, err := watch(f.path)
+	if err != nil {
+		fmt.Printf("watch %s failed,use polling,err:%v\n", f.path, err)
+		return
+	}
+	f.notify = ch
+}
+
+func (f *follower) stopWatch() {
+	if f.notify != nil {
+		unwatch(f.path, f.notify)
+	}
+}
+
+// wait 等文件有变化,返回false表示已经被Stop
+// 轮询时等一个poll_interval;正在读被改名的旧文件时没有inotify通知,也按poll_interval等
+// 有等着超时发出去的半行时最多等到超时
+func (f *follower) wait() bool {
+	var notify <-chan struct{}
+	timeout := f.entry.PollInterval
+	if f.notify != nil && !f.draining {
+		notify = f.notify
+		timeout = inotifyFallbackInterval
+	}
+	if f.partialSize > 0 {
+		//半行到时间要发出去,不能一直等文件变化
+		if d := f.entry.PartialLineTimeout - time.Since(f.partialAt); d < timeout {
+			timeout = d
+		}
+	}
+	select {
+	case <-notify:
+		return true
+	case <-time.After(timeout):
+		return true
+	case <-f.done:
+		return false
+	}
+}
+
+// Stop 停止跟踪,lines会被关闭
+func (f *follower) Stop() {
+	close(f.done)
+}
+
+// finish 文件被删除或改名后不再匹配通配符,读完已经打开的文件再退出,lines会被关闭
+// 不再切到同一路径上新建的文件,新文件由重新扫描时启动的任务从头读
+func (f *follower) finish() {
+	close(f.gone)
+}
+
+func (f *follower) isGone() bool {
+	select {
+	case <-f.gone:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,30 @@
+//go:build linux
+// +build linux
+
+package taillog
+
+import (
+	"syscall"
+)
+
+// 这些文件系统上inotify收不到其他机器或下层目录的修改
+const (
+	nfsSuperMagic       = 0x6969
+	smbSuperMagic       = 0x517b
+	cifsMagicNumber     = 0xff534d42
+	fuseSuperMagic      = 0x65735546
+	overlayfsSuperMagic = 0x794c7630
+)
+
+// inotifyUnreliable 判断path所在的文件系统能不能用inotify
+func inotifyUnreliable(path string) bool {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return false
+	}
+	switch uint32(st.Type) {
+	case nfsSuperMagic, smbSuperMagic, cifsMagicNumber, fuseSuperMagic, overlayfsSuperMagic:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+// +build !linux
+
+package taillog
+
+// inotifyUnreliable 只在linux下识别文件系统类型
+func inotifyUnreliable(path string) bool {
+	return false
+}
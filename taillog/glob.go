@@ -0,0 +1,102 @@
+package taillog
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+//把收集项里的path展开成具体的文件列表
+//支持filepath.Match的通配符,另外支持用**匹配任意层(包括0层)目录
+
+// isGlob 判断path里是否有通配符
+func isGlob(path string) bool {
+	return strings.ContainsAny(path, "*?[")
+}
+
+// expandPath 返回pattern匹配到的所有普通文件
+func expandPath(pattern string) (files []string, err error) {
+	if !isGlob(pattern) {
+		return []string{pattern}, nil
+	}
+	if !strings.Contains(pattern, "**") {
+		var matches []string
+		matches, err = filepath.Glob(pattern)
+		if err != nil {
+			return
+		}
+		for _, m := range matches {
+			if isRegular(m) {
+				files = append(files, m)
+			}
+		}
+		return
+	}
+
+	//从第一个带通配符的目录开始遍历,逐段匹配
+	pattern = filepath.Clean(pattern)
+	segs := strings.Split(pattern, string(filepath.Separator))
+	i := 0
+	for i < len(segs) && !isGlob(segs[i]) {
+		i++
+	}
+	root := strings.Join(segs[:i], string(filepath.Separator))
+	if root == "" {
+		if filepath.IsAbs(pattern) {
+			root = string(filepath.Separator)
+		} else {
+			root = "."
+		}
+	}
+	err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil //没有权限等错误直接跳过这个目录
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			//Walk用的是Lstat,要和*一样跟着软链接找到文件,比如k8s的/var/log/containers;指向目录的软链接不进去,免得绕圈
+			if target, err := os.Stat(path); err == nil {
+				info = target
+			}
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return nil
+		}
+		if matchSegments(segs[i:], strings.Split(rel, string(filepath.Separator))) {
+			files = append(files, path)
+		}
+		return nil
+	})
+	return
+}
+
+// matchSegments 逐段匹配,**可以匹配0个或多个目录
+func matchSegments(pattern, path []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(path); i++ {
+				if matchSegments(pattern[1:], path[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(path) == 0 {
+			return false
+		}
+		ok, err := filepath.Match(pattern[0], path[0])
+		if err != nil || !ok {
+			return false
+		}
+		pattern, path = pattern[1:], path[1:]
+	}
+	return len(path) == 0
+}
+
+func isRegular(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.Mode().IsRegular()
+}
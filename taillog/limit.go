@@ -0,0 +1,68 @@
+package taillog
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+//控制follower打开的文件句柄
+//  close_inactive:超过这么久没有读到新数据就关闭文件,文件有变化时再打开
+//  max_open_files:最多同时打开多少个文件,超出的follower按先来后到排队
+
+// openFiles 同时打开文件数的信号量,为nil时不限制
+// 阻塞在同一个chan上的发送方按先后顺序被唤醒,所以排队是公平的
+var openFiles chan struct{}
+
+func initOpenFiles(max int) {
+	openFiles = nil
+	if max > 0 {
+		openFiles = make(chan struct{}, max)
+	}
+}
+
+// acquire 占一个打开文件的名额,返回false表示已经被Stop
+func (f *follower) acquire() bool {
+	if openFiles == nil {
+		return true
+	}
+	select {
+	case openFiles <- struct{}{}:
+		return true
+	default:
+	}
+	fmt.Printf("max_open_files %d reached,%s is waiting\n", cap(openFiles), f.path)
+	select {
+	case openFiles <- struct{}{}:
+		return true
+	case <-f.done:
+		return false
+	}
+}
+
+func release() {
+	if openFiles != nil {
+		<-openFiles
+	}
+}
+
+// closeIfInactive 读到文件末尾时检查是不是太久没有新数据,是的话关闭文件让出名额
+func (f *follower) closeIfInactive() bool {
+	if f.entry.CloseInactive <= 0 || f.draining || time.Since(f.lastRead) < f.entry.CloseInactive {
+		return false
+	}
+	fmt.Printf("close %s,no new data in %v\n", f.path, f.entry.CloseInactive)
+	f.closeFile()
+	f.inactive = true
+	return true
+}
+
+// changed 因为不活跃关闭的文件,只有变大、变小或者换了inode才重新打开
+func (f *follower) changed() bool {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return false
+	}
+	dev, ino := fileID(info)
+	return dev != f.state.Dev || ino != f.state.Ino || info.Size() != f.state.Offset
+}
@@ -0,0 +1,190 @@
+package taillog
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+//按分隔符切分文件内容,follower和读切割旧文件时共用
+
+// delimiter 一条日志的结束标记,literal和re只有一个不为空
+type delimiter struct {
+	literal []byte         //固定的分隔符,已经转成日志文件的编码
+	re      *regexp.Regexp //正则分隔符,只能用于utf-8、gbk这类兼容ascii的编码
+	unit    int            //编码的最小单位,utf-16是2,分隔符必须落在整数个单位上
+}
+
+// newDelimiter s为空时用换行符,以regex:开头的是正则,否则是固定字符串,可以写\r\n、\x00这样的转义
+func newDelimiter(s string, c *charset) (d *delimiter, err error) {
+	d = &delimiter{literal: c.delim, unit: c.unit}
+	if s == "" {
+		return
+	}
+	if strings.HasPrefix(s, "regex:") {
+		if c.unit != 1 {
+			return nil, fmt.Errorf("regex delimiter is not supported with encoding %s", c.name)
+		}
+		d.literal = nil
+		d.re, err = regexp.Compile(strings.TrimPrefix(s, "regex:"))
+		if err != nil {
+			return nil, fmt.Errorf("compile delimiter %q failed,err:%v", s, err)
+		}
+		if d.re.MatchString("") {
+			return nil, fmt.Errorf("delimiter %q matches empty string", s)
+		}
+		return
+	}
+	lit, err := strconv.Unquote(`"` + strings.Replace(s, `"`, `\"`, -1) + `"`)
+	if err != nil {
+		return nil, fmt.Errorf("invalid delimiter %q,err:%v", s, err)
+	}
+	d.literal = []byte(lit)
+	if c.enc != nil {
+		d.literal, err = c.enc.NewEncoder().Bytes(d.literal)
+		if err != nil {
+			return nil, fmt.Errorf("encode delimiter %q with %s failed,err:%v", s, c.name, err)
+		}
+		//utf-16的编码器会在前面加上BOM
+		d.literal = bytes.TrimPrefix(d.literal, []byte{0xff, 0xfe})
+		d.literal = bytes.TrimPrefix(d.literal, []byte{0xfe, 0xff})
+	}
+	return
+}
+
+// limitSlack 超过max_bytes的行多留几个字节,解码后再按字符截断,免得截出半个字符
+// regexWindow 超长的行丢掉中间的内容后,留下最后这么多字节继续找正则分隔符
+const (
+	limitSlack  = 8
+	regexWindow = 4096
+)
+
+// record 读到的一行
+type record struct {
+	data      []byte //去掉分隔符的内容,超长时只有开头的一部分
+	size      int    //这一行连同分隔符在文件里一共多少字节
+	truncated bool   //超过max_bytes被截断了
+}
+
+type lineReader struct {
+	reader  *bufio.Reader
+	delim   *delimiter
+	max     int    //一行最多保留多少字节,0表示不限制
+	buf     []byte //还没读到分隔符的半行
+	dropped int    //当前这一行超长丢掉了多少字节
+	eof     bool   //上一次读到了文件末尾
+}
+
+func newLineReader(r io.Reader, d *delimiter, max int) *lineReader {
+	return &lineReader{
+		reader: bufio.NewReaderSize(r, 64*1024),
+		delim:  d,
+		max:    max,
+	}
+}
+
+// next 返回去掉分隔符的一整行
+// 读到文件末尾时返回io.EOF,没有分隔符的半行留在buf里,下次接着读
+func (r *lineReader) next() (rec record, err error) {
+	if r.delim.re != nil {
+		return r.nextRegexp()
+	}
+	delim := r.delim.literal
+	last := delim[len(delim)-1]
+	for {
+		var chunk []byte
+		chunk, err = r.reader.ReadSlice(last)
+		r.buf = append(r.buf, chunk...)
+		r.limit(len(delim))
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err != nil {
+			return
+		}
+		if bytes.HasSuffix(r.buf, delim) && (len(r.buf)+r.dropped)%r.delim.unit == 0 {
+			rec = r.take(len(r.buf)-len(delim), len(r.buf))
+			return
+		}
+	}
+}
+
+// nextRegexp 正则可能匹配更长的内容,所以匹配到buf末尾时要等读到文件末尾才算数
+func (r *lineReader) nextRegexp() (rec record, err error) {
+	chunk := make([]byte, 4096)
+	for {
+		//丢掉过中间内容的行只在最后留下的窗口里找分隔符
+		start := 0
+		if r.dropped > 0 {
+			start = r.max + limitSlack
+		}
+		if loc := r.delim.re.FindIndex(r.buf[start:]); loc != nil && (start+loc[1] < len(r.buf) || r.eof) {
+			return r.take(start+loc[0], start+loc[1]), nil
+		}
+		if r.eof {
+			r.eof = false
+			return rec, io.EOF
+		}
+		var n int
+		n, err = r.reader.Read(chunk)
+		r.buf = append(r.buf, chunk[:n]...)
+		r.limit(regexWindow)
+		if err == io.EOF {
+			r.eof = true
+		} else if err != nil {
+			return
+		}
+	}
+}
+
+// limit 半行超过max_bytes时只留下开头和最后keep个字节(用来判断分隔符),中间的丢掉
+func (r *lineReader) limit(keep int) {
+	head := r.max + limitSlack
+	if r.max <= 0 || len(r.buf) <= head+keep {
+		return
+	}
+	r.dropped += len(r.buf) - head - keep
+	r.buf = append(r.buf[:head], r.buf[len(r.buf)-keep:]...)
+}
+
+// take 取出buf[:end]作为一行,buf[:next]从buf里去掉
+func (r *lineReader) take(end, next int) (rec record) {
+	rec = record{
+		data:      r.head(end),
+		size:      next + r.dropped,
+		truncated: r.dropped > 0,
+	}
+	r.buf = append([]byte(nil), r.buf[next:]...)
+	r.dropped = 0
+	return
+}
+
+// head buf[:end],丢过中间内容的行只要开头,后面留着找分隔符的部分和开头接不上
+func (r *lineReader) head(end int) []byte {
+	if head := r.max + limitSlack; r.dropped > 0 && end > head {
+		end = head
+	}
+	return r.buf[:end]
+}
+
+// pending 没有分隔符的半行
+func (r *lineReader) pending() record {
+	return record{data: r.head(len(r.buf)), size: len(r.buf) + r.dropped, truncated: r.dropped > 0}
+}
+
+// flush 取出没有分隔符的半行,之后的内容作为新的一行
+func (r *lineReader) flush() record {
+	return r.take(len(r.buf), len(r.buf))
+}
+
+// reset 换了文件或者文件被清空后丢掉缓存的内容
+func (r *lineReader) reset(rd io.Reader) {
+	r.reader.Reset(rd)
+	r.buf = nil
+	r.dropped = 0
+	r.eof = false
+}
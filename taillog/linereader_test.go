@@ -0,0 +1,198 @@
+package taillog
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+// readAll 一直读到io.EOF,返回读到的行和剩下的半行
+func readAll(t *testing.T, r *lineReader) (recs []record, pending record) {
+	for {
+		rec, err := r.next()
+		if err == io.EOF {
+			return recs, r.pending()
+		}
+		if err != nil {
+			t.Fatalf("next err = %v", err)
+		}
+		rec.data = append([]byte(nil), rec.data...)
+		recs = append(recs, rec)
+	}
+}
+
+func TestLineReader(t *testing.T) {
+	long := strings.Repeat("x", 5000)
+	tests := []struct {
+		name      string
+		delimiter string
+		encoding  string
+		max       int
+		input     string
+		want      []record
+		pending   record
+	}{
+		{
+			name:    "newline",
+			input:   "a\nbc\n\nd",
+			want:    []record{{data: []byte("a"), size: 2}, {data: []byte("bc"), size: 3}, {data: []byte(""), size: 1}},
+			pending: record{data: []byte("d"), size: 1},
+		},
+		{
+			name:      "crlf",
+			delimiter: `\r\n`,
+			input:     "a\r\nb\nc\r\n",
+			want:      []record{{data: []byte("a"), size: 3}, {data: []byte("b\nc"), size: 5}},
+		},
+		{
+			name:      "escaped nul",
+			delimiter: `\x00`,
+			input:     "a\x00b\nc\x00",
+			want:      []record{{data: []byte("a"), size: 2}, {data: []byte("b\nc"), size: 4}},
+		},
+		{
+			name:      "multi-byte literal",
+			delimiter: "||",
+			input:     "a|b||c||d|",
+			want:      []record{{data: []byte("a|b"), size: 5}, {data: []byte("c"), size: 3}},
+			pending:   record{data: []byte("d|"), size: 2},
+		},
+		{
+			name:      "regex",
+			delimiter: `regex:;\s*`,
+			input:     "a; b;;c",
+			want:      []record{{data: []byte("a"), size: 3}, {data: []byte("b"), size: 2}, {data: []byte(""), size: 1}},
+			pending:   record{data: []byte("c"), size: 1},
+		},
+		{
+			name:      "regex match at end of file",
+			delimiter: `regex:;\s*`,
+			input:     "a;  ",
+			want:      []record{{data: []byte("a"), size: 4}},
+		},
+		{
+			name:     "utf-16le",
+			encoding: "utf-16le",
+			input:    "a\x00\n\x00b\x00",
+			want:     []record{{data: []byte("a\x00"), size: 4}},
+			pending:  record{data: []byte("b\x00"), size: 2},
+		},
+		{
+			//U+0A41 U+0100是41 0a 00 01,中间的0a 00没有对齐到2字节,不是换行
+			name:     "utf-16le unaligned delimiter",
+			encoding: "utf-16le",
+			input:    "\x41\x0a\x00\x01\x0a\x00",
+			want:     []record{{data: []byte("\x41\x0a\x00\x01"), size: 6}},
+		},
+		{
+			name:      "utf-16le literal",
+			encoding:  "utf-16le",
+			delimiter: `;`,
+			input:     "a\x00;\x00b\x00;\x00",
+			want:      []record{{data: []byte("a\x00"), size: 4}, {data: []byte("b\x00"), size: 4}},
+		},
+		{
+			name:     "utf-16be",
+			encoding: "utf-16be",
+			input:    "\x00a\x00\n\x00b",
+			want:     []record{{data: []byte("\x00a"), size: 4}},
+			pending:  record{data: []byte("\x00b"), size: 2},
+		},
+		{
+			//超过max_bytes时留下开头max+limitSlack个字节
+			name:  "max bytes",
+			max:   4,
+			input: "abcdefghijklmnopqrstuvwxyz\nabcdefghijkl\nz",
+			want: []record{
+				{data: []byte("abcdefghijkl"), size: 27, truncated: true},
+				{data: []byte("abcdefghijkl"), size: 13},
+			},
+			pending: record{data: []byte("z"), size: 1},
+		},
+		{
+			name:    "max bytes pending",
+			max:     4,
+			input:   "a\n" + long,
+			want:    []record{{data: []byte("a"), size: 2}},
+			pending: record{data: []byte(long[:12]), size: 5000, truncated: true},
+		},
+		{
+			name:      "max bytes regex",
+			delimiter: "regex:;",
+			max:       4,
+			input:     long + ";y;",
+			want:      []record{{data: []byte(long[:12]), size: 5001, truncated: true}, {data: []byte("y"), size: 2}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := newCharset(tt.encoding)
+			if err != nil {
+				t.Fatal(err)
+			}
+			d, err := newDelimiter(tt.delimiter, c)
+			if err != nil {
+				t.Fatal(err)
+			}
+			recs, pending := readAll(t, newLineReader(strings.NewReader(tt.input), d, tt.max))
+			if len(recs) != len(tt.want) {
+				t.Fatalf("got %d records %v, want %d", len(recs), recs, len(tt.want))
+			}
+			for i, rec := range recs {
+				if !sameRecord(rec, tt.want[i]) {
+					t.Errorf("record %d = %q/%d/%v, want %q/%d/%v", i, rec.data, rec.size, rec.truncated, tt.want[i].data, tt.want[i].size, tt.want[i].truncated)
+				}
+			}
+			if !sameRecord(pending, tt.pending) {
+				t.Errorf("pending = %q/%d/%v, want %q/%d/%v", pending.data, pending.size, pending.truncated, tt.pending.data, tt.pending.size, tt.pending.truncated)
+			}
+		})
+	}
+}
+
+func sameRecord(a, b record) bool {
+	return bytes.Equal(a.data, b.data) && a.size == b.size && a.truncated == b.truncated
+}
+
+// TestLineReaderFollow 文件还在写的时候,半行读到EOF后接着读,或者超时后用flush发出去
+func TestLineReaderFollow(t *testing.T) {
+	c, _ := newCharset("")
+	d, _ := newDelimiter("", c)
+	file := &bytes.Buffer{}
+	r := newLineReader(file, d, 0)
+
+	file.WriteString("ab")
+	if _, err := r.next(); err != io.EOF {
+		t.Fatalf("next err = %v, want EOF", err)
+	}
+	file.WriteString("c\nde")
+	rec, err := r.next()
+	if err != nil || string(rec.data) != "abc" || rec.size != 4 {
+		t.Fatalf("next = %q/%d, %v, want abc/4", rec.data, rec.size, err)
+	}
+	if _, err := r.next(); err != io.EOF {
+		t.Fatalf("next err = %v, want EOF", err)
+	}
+	rec = r.flush()
+	if string(rec.data) != "de" || rec.size != 2 {
+		t.Fatalf("flush = %q/%d, want de/2", rec.data, rec.size)
+	}
+	if p := r.pending(); p.size != 0 {
+		t.Fatalf("pending after flush = %q/%d", p.data, p.size)
+	}
+	//flush之后的内容是新的一行
+	file.WriteString("f\n")
+	rec, err = r.next()
+	if err != nil || string(rec.data) != "f" || rec.size != 2 {
+		t.Fatalf("next = %q/%d, %v, want f/2", rec.data, rec.size, err)
+	}
+
+	file.WriteString("stale")
+	r.next()
+	r.reset(strings.NewReader("g\n"))
+	rec, err = r.next()
+	if err != nil || string(rec.data) != "g" || rec.size != 2 {
+		t.Fatalf("next after reset = %q/%d, %v, want g/2", rec.data, rec.size, err)
+	}
+}
@@ -0,0 +1,114 @@
+package taillog
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"test/conf"
+	"time"
+)
+
+//把多行日志(比如java异常栈、go的panic)合并成一条再发送
+
+// message 合并好的一条日志,state是它最后一行读完之后的收集进度,用来更新registry
+type message struct {
+	text      string
+	state     FileState
+	fields    map[string]string
+	truncated bool
+}
+
+type multiline struct {
+	pattern     *regexp.Regexp
+	negate      bool //为true时不匹配pattern的行才算匹配
+	matchBefore bool //false:匹配的行接到上一行后面 true:匹配的行接到下一行前面
+	maxLines    int  //一条日志最多多少行,超出的行丢弃
+	timeout     time.Duration
+
+	lines     []string
+	state     FileState
+	fields    map[string]string //合并后的日志用第一行的元数据
+	truncated bool              //有一行被截断了,或者超过maxLines丢掉了行
+	dropped   int
+}
+
+// newMultiline 收集项没有配置multiline_pattern时返回nil
+func newMultiline(entry *conf.CollectEntry) (m *multiline, err error) {
+	if entry.MultilinePattern == "" {
+		return
+	}
+	pattern, err := regexp.Compile(entry.MultilinePattern)
+	if err != nil {
+		return nil, fmt.Errorf("compile multiline_pattern %q failed,err:%v", entry.MultilinePattern, err)
+	}
+	m = &multiline{
+		pattern:  pattern,
+		negate:   entry.MultilineNegate,
+		maxLines: entry.MultilineMaxLines,
+		timeout:  entry.MultilineTimeout,
+	}
+	switch entry.MultilineMatch {
+	case "after", "":
+	case "before":
+		m.matchBefore = true
+	default:
+		return nil, fmt.Errorf("invalid multiline_match %q,must be after or before", entry.MultilineMatch)
+	}
+	return
+}
+
+// add 加入一行,返回已经合并完成的日志
+func (m *multiline) add(l *line) (msgs []message) {
+	matched := m.pattern.MatchString(l.text) != m.negate
+	if m.matchBefore {
+		m.append(l)
+		if !matched {
+			//不匹配的行是这条日志的最后一行
+			msgs = append(msgs, m.flush())
+		}
+		return
+	}
+	if !matched && len(m.lines) > 0 {
+		//不匹配的行是新日志的第一行
+		msgs = append(msgs, m.flush())
+	}
+	m.append(l)
+	return
+}
+
+func (m *multiline) append(l *line) {
+	if len(m.lines) == 0 {
+		m.fields = l.fields
+	}
+	m.state = l.state
+	m.truncated = m.truncated || l.truncated
+	if m.maxLines > 0 && len(m.lines) >= m.maxLines {
+		//丢掉了行的日志和超长截断的一样带上truncated=true
+		m.dropped++
+		m.truncated = true
+		return
+	}
+	m.lines = append(m.lines, l.text)
+}
+
+// pending 是否有还没合并完的行
+func (m *multiline) pending() bool {
+	return len(m.lines) > 0
+}
+
+// flush 把缓存的行合并成一条日志
+func (m *multiline) flush() (msg message) {
+	if m.dropped > 0 {
+		fmt.Printf("multiline event exceeds %d lines,%d lines dropped\n", m.maxLines, m.dropped)
+	}
+	msg = message{
+		text:      strings.Join(m.lines, "\n"),
+		state:     m.state,
+		fields:    m.fields,
+		truncated: m.truncated,
+	}
+	m.lines = m.lines[:0]
+	m.truncated = false
+	m.dropped = 0
+	return
+}
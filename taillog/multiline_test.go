@@ -0,0 +1,138 @@
+package taillog
+
+import (
+	"reflect"
+	"strconv"
+	"test/conf"
+	"testing"
+)
+
+func TestMultiline(t *testing.T) {
+	tests := []struct {
+		name    string
+		entry   conf.CollectEntry
+		lines   []string
+		cut     map[int]bool //第几行(从0开始)超过max_bytes被截断了
+		want    []message
+		pending bool    //最后还有没合并完的行
+		flushed message //最后flush出来的
+	}{
+		{
+			name:  "after",
+			entry: conf.CollectEntry{MultilinePattern: `^\s`, MultilineMatch: "after"},
+			lines: []string{"a", " b", " c", "d", " e"},
+			want: []message{
+				{text: "a\n b\n c", state: FileState{Offset: 3}, fields: map[string]string{"n": "0"}},
+			},
+			pending: true,
+			flushed: message{text: "d\n e", state: FileState{Offset: 5}, fields: map[string]string{"n": "3"}},
+		},
+		{
+			name:  "after negate",
+			entry: conf.CollectEntry{MultilinePattern: `^\d{4}-`, MultilineNegate: true, MultilineMatch: "after"},
+			lines: []string{"2024-01 x", "  at y", "Caused by: z", "2024-02 w"},
+			want: []message{
+				{text: "2024-01 x\n  at y\nCaused by: z", state: FileState{Offset: 3}, fields: map[string]string{"n": "0"}},
+			},
+			pending: true,
+			flushed: message{text: "2024-02 w", state: FileState{Offset: 4}, fields: map[string]string{"n": "3"}},
+		},
+		{
+			name:  "before",
+			entry: conf.CollectEntry{MultilinePattern: `\\$`, MultilineMatch: "before"},
+			lines: []string{`a \`, `b \`, "c", "d"},
+			want: []message{
+				{text: "a \\\nb \\\nc", state: FileState{Offset: 3}, fields: map[string]string{"n": "0"}},
+				{text: "d", state: FileState{Offset: 4}, fields: map[string]string{"n": "3"}},
+			},
+		},
+		{
+			name:  "before negate",
+			entry: conf.CollectEntry{MultilinePattern: `;$`, MultilineNegate: true, MultilineMatch: "before"},
+			lines: []string{"select *", "from t;", "x"},
+			want: []message{
+				{text: "select *\nfrom t;", state: FileState{Offset: 2}, fields: map[string]string{"n": "0"}},
+			},
+			pending: true,
+			flushed: message{text: "x", state: FileState{Offset: 3}, fields: map[string]string{"n": "2"}},
+		},
+		{
+			//超出的行丢掉,但是进度要算到最后一行,免得重启后再读一遍
+			name:  "max lines",
+			entry: conf.CollectEntry{MultilinePattern: `^\s`, MultilineMatch: "after", MultilineMaxLines: 2},
+			lines: []string{"a", " b", " c", " d", "e"},
+			want: []message{
+				{text: "a\n b", state: FileState{Offset: 4}, fields: map[string]string{"n": "0"}, truncated: true},
+			},
+			pending: true,
+			flushed: message{text: "e", state: FileState{Offset: 5}, fields: map[string]string{"n": "4"}},
+		},
+		{
+			name:  "truncated line",
+			entry: conf.CollectEntry{MultilinePattern: `^\s`, MultilineMatch: "after"},
+			lines: []string{"a", " b", "c"},
+			cut:   map[int]bool{1: true},
+			want: []message{
+				{text: "a\n b", state: FileState{Offset: 2}, fields: map[string]string{"n": "0"}, truncated: true},
+			},
+			pending: true,
+			flushed: message{text: "c", state: FileState{Offset: 3}, fields: map[string]string{"n": "2"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := newMultiline(&tt.entry)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []message
+			for i, text := range tt.lines {
+				l := &line{
+					text:      text,
+					state:     FileState{Offset: int64(i + 1)},
+					fields:    map[string]string{"n": strconv.Itoa(i)},
+					truncated: tt.cut[i],
+				}
+				got = append(got, m.add(l)...)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("add = %+v, want %+v", got, tt.want)
+			}
+			if m.pending() != tt.pending {
+				t.Fatalf("pending = %v, want %v", m.pending(), tt.pending)
+			}
+			if !tt.pending {
+				return
+			}
+			if msg := m.flush(); !reflect.DeepEqual(msg, tt.flushed) {
+				t.Errorf("flush = %+v, want %+v", msg, tt.flushed)
+			}
+			if m.pending() {
+				t.Errorf("pending after flush")
+			}
+		})
+	}
+}
+
+func TestNewMultiline(t *testing.T) {
+	tests := []struct {
+		entry   conf.CollectEntry
+		wantNil bool
+		wantErr bool
+	}{
+		{entry: conf.CollectEntry{}, wantNil: true},
+		{entry: conf.CollectEntry{MultilinePattern: `^\s`}},
+		{entry: conf.CollectEntry{MultilinePattern: `^\s`, MultilineMatch: "middle"}, wantErr: true},
+		{entry: conf.CollectEntry{MultilinePattern: `(`}, wantErr: true},
+	}
+	for _, tt := range tests {
+		m, err := newMultiline(&tt.entry)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("newMultiline(%+v) err = %v, wantErr %v", tt.entry, err, tt.wantErr)
+			continue
+		}
+		if err == nil && (m == nil) != tt.wantNil {
+			t.Errorf("newMultiline(%+v) = %v, wantNil %v", tt.entry, m, tt.wantNil)
+		}
+	}
+}
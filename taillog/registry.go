@@ -0,0 +1,172 @@
+package taillog
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+//记录每个文件读到了哪里,重启后从记录的位置继续读
+
+// FileState 一个文件的收集进度
+type FileState struct {
+	ID          string    `json:"id,omitempty"` //按指纹识别文件时的key
+	Source      string    `json:"source"`       //最后一次见到这个文件时的路径
+	Dev         uint64    `json:"dev"`
+	Ino         uint64    `json:"ino"`
+	Fingerprint string    `json:"fingerprint,omitempty"` //文件开头fingerprint_size字节的sha256
+	Offset      int64     `json:"offset"`                //最后一行交出去之后的字节偏移,压缩文件是解压后的偏移
+	Done        bool      `json:"done,omitempty"`        //切割出来的旧文件已经全部读完
+	Timestamp   time.Time `json:"timestamp"`
+}
+
+// Key 有ID时用ID,否则按设备号和inode识别文件,取不到inode时退化成按路径
+func (s *FileState) Key() string {
+	if s.ID != "" {
+		return s.ID
+	}
+	if s.Ino == 0 {
+		return s.Source
+	}
+	return fmt.Sprintf("%d-%d", s.Dev, s.Ino)
+}
+
+type registry struct {
+	lock     sync.Mutex
+	path     string
+	ttl      time.Duration //超过这么久没有更新、也没有被follower占用的记录会被清掉,比如切割后被删除的旧文件
+	states   map[string]*FileState
+	held     map[*follower][]string //follower正在跟踪的文件和还在的旧文件的key,这些记录不会过期
+	loadedAt time.Time              //重启后follower还没来得及打开文件,加载的记录至少再保留一个ttl
+	dirty    bool
+}
+
+// newRegistry 从磁盘加载registry文件,文件不存在时返回空的registry
+func newRegistry(path string, ttl time.Duration) (r *registry, err error) {
+	r = &registry{
+		path:     path,
+		ttl:      ttl,
+		states:   make(map[string]*FileState),
+		held:     make(map[*follower][]string),
+		loadedAt: time.Now(),
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return r, nil
+	}
+	if err != nil {
+		return
+	}
+	var states []*FileState
+	err = json.Unmarshal(data, &states)
+	if err != nil {
+		return nil, fmt.Errorf("parse registry %s failed,err:%v", path, err)
+	}
+	for _, s := range states {
+		r.states[s.Key()] = s
+	}
+	return
+}
+
+// get 按key取文件的收集进度,没有记录时返回nil
+func (r *registry) get(key string) *FileState {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	s, ok := r.states[key]
+	if !ok {
+		return nil
+	}
+	state := *s
+	return &state
+}
+
+func (r *registry) update(state FileState) {
+	state.Timestamp = time.Now()
+	r.lock.Lock()
+	r.states[state.Key()] = &state
+	r.dirty = true
+	r.lock.Unlock()
+}
+
+// findFingerprint 按文件开头的指纹找记录,压缩后的旧文件inode变了,靠它认出原来的文件
+func (r *registry) findFingerprint(fingerprint string) *FileState {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for _, s := range r.states {
+		if s.Fingerprint == fingerprint {
+			state := *s
+			return &state
+		}
+	}
+	return nil
+}
+
+// hold follower占用这些key,keys为空时释放
+func (r *registry) hold(f *follower, keys []string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if len(keys) == 0 {
+		delete(r.held, f)
+		return
+	}
+	r.held[f] = keys
+}
+
+// flush 先写临时文件再rename,避免写一半时进程退出把registry写坏
+func (r *registry) flush() (err error) {
+	r.lock.Lock()
+	if !r.dirty {
+		r.lock.Unlock()
+		return
+	}
+	held := make(map[string]bool)
+	for _, keys := range r.held {
+		for _, key := range keys {
+			held[key] = true
+		}
+	}
+	states := make([]*FileState, 0, len(r.states))
+	for key, s := range r.states {
+		if held[key] {
+			//很久没有新内容的文件(比如每周一次的cron日志)也不能过期,否则重启后会按start_position跳过内容
+			s.Timestamp = time.Now()
+		} else if r.ttl > 0 && time.Since(s.Timestamp) > r.ttl && time.Since(r.loadedAt) > r.ttl {
+			delete(r.states, key)
+			continue
+		}
+		states = append(states, s)
+	}
+	data, err := json.Marshal(states)
+	r.dirty = false
+	r.lock.Unlock()
+	if err != nil {
+		return
+	}
+
+	err = os.MkdirAll(filepath.Dir(r.path), 0755)
+	if err != nil {
+		return
+	}
+	tmp := r.path + ".tmp"
+	err = ioutil.WriteFile(tmp, data, 0644)
+	if err != nil {
+		return
+	}
+	return os.Rename(tmp, r.path)
+}
+
+// run 定时把收集进度写到磁盘
+func (r *registry) run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		err := r.flush()
+		if err != nil {
+			fmt.Printf("flush registry %s failed,err:%v\n", r.path, err)
+		}
+	}
+}
@@ -2,31 +2,131 @@ package taillog
 
 import (
 	"fmt"
-	"github.com/hpcloud/tail"
-)
-
-var (
-	tails *tail.Tail
+	"os"
+	"test/conf"
+	"test/event"
+	"time"
 )
 
 //专门从日志文件收集日志的模块
 
-func Init(fileName string) (err error) {
-	config := tail.Config{
-		ReOpen:    true,                                 //重新打开
-		Follow:    true,                                 //是否跟随
-		Location:  &tail.SeekInfo{Offset: 0, Whence: 2}, //从文件的哪个地方开始读
-		MustExist: false,                                //文件不存在报错
-		Poll:      true,
+// TailTask 一个日志收集任务,对应一个收集项
+type TailTask struct {
+	path     string
+	topic    string
+	entry    *conf.CollectEntry //所属的收集项,path可能是entry.Path通配出来的某个文件
+	instance *follower
+	reg      *registry
+	ml       *multiline       //没有配置多行合并时为nil
+	parser   *containerParser //format为plain时为nil
+}
+
+// NewTailTask fromStart表示这是启动后才出现的文件,不管start_position都从头读,免得漏掉扫描到它之前写的内容
+func NewTailTask(path string, entry *conf.CollectEntry, reg *registry, fromStart bool) (tailObj *TailTask, err error) {
+	tailObj = &TailTask{
+		path:  path,
+		topic: entry.Topic,
+		entry: entry,
+		reg:   reg,
+	}
+	tailObj.ml, err = newMultiline(entry)
+	if err != nil {
+		return
+	}
+	tailObj.parser, err = newContainerParser(entry.Format)
+	if err != nil {
+		return
+	}
+	c, err := newCharset(entry.Encoding)
+	if err != nil {
+		return
+	}
+	d, err := newDelimiter(entry.Delimiter, c)
+	if err != nil {
+		return
 	}
-	tails, err = tail.TailFile(fileName, config) //打开文件
+	err = checkStartPosition(entry)
 	if err != nil {
-		fmt.Println("tail file failed,err", err)
 		return
 	}
+	err = checkFileIdentity(entry)
+	if err != nil {
+		return
+	}
+	err = checkWatchMode(entry)
+	if err != nil {
+		return
+	}
+	if entry.MustExist {
+		_, err = os.Stat(path) //文件不存在报错
+		if err != nil {
+			fmt.Println("tail file failed,err", err)
+			return
+		}
+	}
+	tailObj.instance = newFollower(path, reg, entry, c, d)
+	tailObj.instance.fromStart = fromStart
+	go tailObj.instance.run()
 	return
 }
 
-func ReadChan() <-chan *tail.Line {
-	return tails.Lines
+// run 把读到的每一行(配置了多行合并时是合并后的日志)打上topic后发到taskMgr的logChan
+func (t *TailTask) run(logChan chan<- *event.Event) {
+	var timeout <-chan time.Time //有没合并完的行时,超过multiline_timeout没有新行就直接发出去
+	for {
+		select {
+		case l, ok := <-t.instance.lines:
+			if !ok {
+				if t.ml != nil && t.ml.pending() {
+					t.send(logChan, t.ml.flush())
+				}
+				return
+			}
+			if t.parser != nil {
+				if l = t.parser.parse(l); l == nil {
+					continue //被拆开的容器日志还没拼完整
+				}
+			}
+			if t.ml == nil {
+				t.send(logChan, message{text: l.text, state: l.state, fields: l.fields, truncated: l.truncated})
+				continue
+			}
+			for _, msg := range t.ml.add(l) {
+				t.send(logChan, msg)
+			}
+			timeout = nil
+			if t.ml.pending() {
+				timeout = time.After(t.ml.timeout)
+			}
+		case <-timeout:
+			t.send(logChan, t.ml.flush())
+			timeout = nil
+		}
+	}
+}
+
+// send 一条日志交出去之后更新registry里的偏移
+func (t *TailTask) send(logChan chan<- *event.Event, msg message) {
+	ev := &event.Event{
+		Topic:    t.topic,
+		Data:     msg.text,
+		Fields:   msg.fields, //容器日志的stream和time
+		Pipeline: "taillog." + t.entry.Name,
+	}
+	ev.Truncate(t.entry.MaxBytes)
+	if msg.truncated {
+		ev.SetField("truncated", "true")
+	}
+	logChan <- ev
+	t.reg.update(msg.state)
+}
+
+// Stop 停止收集,run会在follower关闭lines后退出
+func (t *TailTask) Stop() {
+	t.instance.Stop()
+}
+
+// finish 读完已经打开的文件再停止,文件被删除时还没读完的内容不会丢
+func (t *TailTask) finish() {
+	t.instance.finish()
 }
@@ -0,0 +1,106 @@
+package taillog
+
+import (
+	"fmt"
+	"sync"
+	"test/conf"
+	"test/event"
+	"time"
+)
+
+//管理所有日志收集任务
+
+var taskMgr *tailLogMgr
+
+type tailLogMgr struct {
+	lock     sync.Mutex
+	registry *registry
+	tasks    map[string]*TailTask //key为具体的日志文件路径
+	logChan  chan *event.Event    //所有任务读到的日志都汇总到这里
+}
+
+// Init 加载registry并为每个收集项启动收集任务
+// path带通配符的收集项会按scan_frequency定时重新扫描,收集新出现的文件,已经消失的文件读完剩下的内容后停掉
+func Init(cfg *conf.AppConf) (err error) {
+	reg, err := newRegistry(cfg.RegistryConf.Path, cfg.RegistryConf.TTL)
+	if err != nil {
+		return
+	}
+	go reg.run(cfg.RegistryConf.FlushInterval)
+	initOpenFiles(cfg.TaillogConf.MaxOpenFiles)
+
+	entries := cfg.CollectEntries
+
+	taskMgr = &tailLogMgr{
+		registry: reg,
+		tasks:    make(map[string]*TailTask, len(entries)),
+		logChan:  make(chan *event.Event, 1000),
+	}
+	for _, entry := range entries {
+		err = taskMgr.scan(entry, true)
+		if err != nil {
+			return
+		}
+		if isGlob(entry.Path) {
+			go taskMgr.rescan(entry)
+		}
+	}
+	return
+}
+
+// scan 展开收集项的path,为新文件启动收集任务
+// initial表示启动时的第一次扫描,只有这时找到的文件按start_position开始读,之后新出现的文件都从头读
+func (t *tailLogMgr) scan(entry *conf.CollectEntry, initial bool) (err error) {
+	files, err := expandPath(entry.Path)
+	if err != nil {
+		return
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	found := make(map[string]bool, len(files))
+	for _, path := range files {
+		found[path] = true
+		if _, ok := t.tasks[path]; ok {
+			continue //同一个文件只收集一次
+		}
+		var tailObj *TailTask
+		tailObj, err = NewTailTask(path, entry, t.registry, !initial)
+		if err != nil {
+			return
+		}
+		fmt.Printf("start tail %s for %s\n", path, entry.Name)
+		t.tasks[path] = tailObj
+		go tailObj.run(t.logChan)
+	}
+	if !isGlob(entry.Path) {
+		return
+	}
+	for path, tailObj := range t.tasks {
+		if tailObj.entry == entry && !found[path] {
+			fmt.Printf("stop tail %s after reading the rest of it,file is gone\n", path)
+			tailObj.finish()
+			delete(t.tasks, path)
+		}
+	}
+	return
+}
+
+func (t *tailLogMgr) rescan(entry *conf.CollectEntry) {
+	ticker := time.NewTicker(entry.ScanFrequency)
+	defer ticker.Stop()
+	for range ticker.C {
+		err := t.scan(entry, false)
+		if err != nil {
+			fmt.Printf("scan %s failed,err:%v\n", entry.Path, err)
+		}
+	}
+}
+
+// ReadChan 没有初始化时(stdin、import模式)返回nil
+func ReadChan() <-chan *event.Event {
+	if taskMgr == nil {
+		return nil
+	}
+	return taskMgr.logChan
+}
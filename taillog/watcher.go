@@ -0,0 +1,126 @@
+package taillog
+
+import (
+	"fmt"
+	"gopkg.in/fsnotify.v1"
+	"path/filepath"
+	"sync"
+	"test/conf"
+)
+
+//用inotify监听日志文件所在的目录,文件有写入、创建、改名、删除时唤醒对应的follower
+//所有follower共用一个fsnotify.Watcher,同一个目录只监听一次
+
+var (
+	dirWatcher     *watcher
+	dirWatcherOnce sync.Once
+	dirWatcherErr  error
+)
+
+type watcher struct {
+	lock sync.Mutex
+	w    *fsnotify.Watcher
+	dirs map[string]int                    //每个目录被多少个文件引用
+	subs map[string]map[chan struct{}]bool //key为文件路径
+}
+
+func getWatcher() (*watcher, error) {
+	dirWatcherOnce.Do(func() {
+		var w *fsnotify.Watcher
+		w, dirWatcherErr = fsnotify.NewWatcher()
+		if dirWatcherErr != nil {
+			return
+		}
+		dirWatcher = &watcher{
+			w:    w,
+			dirs: make(map[string]int),
+			subs: make(map[string]map[chan struct{}]bool),
+		}
+		go dirWatcher.run()
+	})
+	return dirWatcher, dirWatcherErr
+}
+
+func checkWatchMode(entry *conf.CollectEntry) error {
+	switch entry.WatchMode {
+	case "inotify", "poll", "auto":
+		return nil
+	}
+	return fmt.Errorf("invalid watch_mode %q,must be inotify, poll or auto", entry.WatchMode)
+}
+
+// watch 监听path,返回的chan在path有变化时可读
+func watch(path string) (ch chan struct{}, err error) {
+	w, err := getWatcher()
+	if err != nil {
+		return
+	}
+	path = filepath.Clean(path)
+	dir := filepath.Dir(path)
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.dirs[dir] == 0 {
+		err = w.w.Add(dir)
+		if err != nil {
+			return
+		}
+	}
+	w.dirs[dir]++
+	ch = make(chan struct{}, 1)
+	if w.subs[path] == nil {
+		w.subs[path] = make(map[chan struct{}]bool)
+	}
+	w.subs[path][ch] = true
+	return
+}
+
+// unwatch 取消监听,目录没有文件引用时不再监听这个目录
+func unwatch(path string, ch chan struct{}) {
+	w := dirWatcher
+	path = filepath.Clean(path)
+	dir := filepath.Dir(path)
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	delete(w.subs[path], ch)
+	if len(w.subs[path]) == 0 {
+		delete(w.subs, path)
+	}
+	w.dirs[dir]--
+	if w.dirs[dir] <= 0 {
+		delete(w.dirs, dir)
+		w.w.Remove(dir)
+	}
+}
+
+func (w *watcher) run() {
+	for {
+		select {
+		case ev := <-w.w.Events:
+			w.lock.Lock()
+			for ch := range w.subs[filepath.Clean(ev.Name)] {
+				notify(ch)
+			}
+			w.lock.Unlock()
+		case err := <-w.w.Errors:
+			//事件队列溢出等错误时可能漏掉了事件,把所有follower都唤醒
+			fmt.Println("inotify watcher failed,err:", err)
+			w.lock.Lock()
+			for _, subs := range w.subs {
+				for ch := range subs {
+					notify(ch)
+				}
+			}
+			w.lock.Unlock()
+		}
+	}
+}
+
+// notify 不阻塞,chan里已经有一个通知时就不用再发了
+func notify(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
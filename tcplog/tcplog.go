@@ -0,0 +1,129 @@
+package tcplog
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"test/conf"
+	"test/event"
+	"test/logio"
+)
+
+//通过tcp接收按换行分隔的日志,可以开启tls并校验客户端证书
+
+var (
+	topic       string
+	maxLineSize int
+	logChan     chan *event.Event
+)
+
+// Init 监听address,address为空时不启动
+func Init(cfg conf.TCPConf) (err error) {
+	if cfg.Address == "" {
+		return
+	}
+	topic = cfg.Topic
+	maxLineSize = cfg.MaxLineSize
+
+	l, err := net.Listen("tcp", cfg.Address)
+	if err != nil {
+		return
+	}
+	if cfg.TLSCert != "" {
+		var tlsConfig *tls.Config
+		tlsConfig, err = newTLSConfig(cfg)
+		if err != nil {
+			l.Close()
+			return
+		}
+		l = tls.NewListener(l, tlsConfig)
+	}
+	logChan = make(chan *event.Event, 1000)
+	go serve(l)
+	return
+}
+
+// newTLSConfig 配置了tls_client_ca时要求客户端出示由它签发的证书
+func newTLSConfig(cfg conf.TCPConf) (tlsConfig *tls.Config, err error) {
+	cert, err := tls.LoadX509KeyPair(cfg.TLSCert, cfg.TLSKey)
+	if err != nil {
+		return
+	}
+	tlsConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+	if cfg.TLSClientCA == "" {
+		return
+	}
+	pem, err := ioutil.ReadFile(cfg.TLSClientCA)
+	if err != nil {
+		return
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificate found in %s", cfg.TLSClientCA)
+	}
+	tlsConfig.ClientCAs = pool
+	tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	return
+}
+
+// ReadChan 没有启动tcp输入时返回nil
+func ReadChan() <-chan *event.Event {
+	return logChan
+}
+
+func serve(l net.Listener) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			fmt.Println("accept tcp failed,err:", err)
+			continue
+		}
+		go serveConn(conn)
+	}
+}
+
+func serveConn(conn net.Conn) {
+	defer conn.Close()
+	fields := map[string]string{"peer": conn.RemoteAddr().String()}
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		//先握手才能拿到客户端证书
+		err := tlsConn.Handshake()
+		if err != nil {
+			fmt.Printf("tls handshake with %s failed,err:%v\n", conn.RemoteAddr(), err)
+			return
+		}
+		if certs := tlsConn.ConnectionState().PeerCertificates; len(certs) > 0 {
+			fields["client_cn"] = certs[0].Subject.CommonName
+		}
+	}
+
+	reader := bufio.NewReader(conn)
+	for {
+		line, truncated, err := logio.ReadLine(reader, maxLineSize)
+		if truncated {
+			fmt.Printf("line exceeds max_line_size %d,truncated\n", maxLineSize)
+		}
+		if line != "" {
+			ev := &event.Event{
+				Topic:    topic,
+				Data:     line,
+				Fields:   fields,
+				Pipeline: "tcp",
+			}
+			if truncated {
+				ev.SetField("truncated", "true")
+			}
+			logChan <- ev
+		}
+		if err != nil {
+			if err != io.EOF {
+				fmt.Printf("read from %s failed,err:%v\n", conn.RemoteAddr(), err)
+			}
+			return
+		}
+	}
+}